@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FoodAvailabilityRequest is the body of UpdateFoodAvailability. Setting
+// Remaining_portions starts counting portions down as they are ordered;
+// Track_portions false stops counting.
+type FoodAvailabilityRequest struct {
+	Sold_out           *bool `json:"sold_out"`
+	Remaining_portions *int  `json:"remaining_portions" validate:"omitempty,min=0"`
+	Track_portions     *bool `json:"track_portions"`
+}
+
+// FoodAvailability is the event sent to terminals when a food's availability changes.
+type FoodAvailability struct {
+	Food_id            string    `json:"food_id"`
+	Name               string    `json:"name"`
+	Sold_out           bool      `json:"sold_out"`
+	Remaining_portions *int      `json:"remaining_portions"`
+	Updated_at         time.Time `json:"updated_at"`
+}
+
+// availabilityBroker fans availability changes out to the terminals streaming
+// them. It lives in memory, so terminals only hear about changes made through
+// the same server instance.
+type availabilityBroker struct {
+	mu      sync.Mutex
+	clients map[chan FoodAvailability]struct{}
+}
+
+var foodAvailabilityBroker = &availabilityBroker{clients: map[chan FoodAvailability]struct{}{}}
+
+func (b *availabilityBroker) subscribe() chan FoodAvailability {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	client := make(chan FoodAvailability, 16)
+	b.clients[client] = struct{}{}
+	return client
+}
+
+func (b *availabilityBroker) unsubscribe(client chan FoodAvailability) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, client)
+}
+
+// publish never blocks: a terminal too slow to keep up misses the event and
+// catches up from GetSoldOutFoods when it reconnects.
+func (b *availabilityBroker) publish(food models.Food) {
+	event := FoodAvailability{
+		Food_id:            food.Food_id,
+		Sold_out:           food.Sold_out,
+		Remaining_portions: food.Remaining_portions,
+		Updated_at:         food.Updated_at,
+	}
+	if food.Name != nil {
+		event.Name = *food.Name
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for client := range b.clients {
+		select {
+		case client <- event:
+		default:
+		}
+	}
+}
+
+// GetSoldOutFoods returns the "86" list: every food that cannot be ordered now.
+func GetSoldOutFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := foodCollection.Find(ctx, bson.M{"sold_out": true, "archived": bson.M{"$ne": true}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing sold out food items"})
+			return
+		}
+
+		foods := []models.Food{}
+		if err = result.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding sold out food items"})
+			return
+		}
+
+		c.JSON(http.StatusOK, foods)
+	}
+}
+
+// StreamFoodAvailability keeps the connection open and sends an
+// "availability" server-sent event every time a food sells out, comes back or
+// its remaining portions change.
+func StreamFoodAvailability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := foodAvailabilityBroker.subscribe()
+		defer foodAvailabilityBroker.unsubscribe(client)
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event := <-client:
+				c.SSEvent("availability", event)
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
+
+// UpdateFoodAvailability lets the kitchen put a food on or take it off the
+// "86" list and set how many portions are left.
+func UpdateFoodAvailability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var availabilityRequest FoodAvailabilityRequest
+
+		foodId := c.Param("food_id")
+
+		if err := c.BindJSON(&availabilityRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(availabilityRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		set := bson.D{{Key: "updated_at", Value: updatedAt}}
+		unset := bson.D{}
+
+		soldOut := availabilityRequest.Sold_out
+		if availabilityRequest.Remaining_portions != nil {
+			set = append(set, bson.E{Key: "remaining_portions", Value: *availabilityRequest.Remaining_portions})
+			// Restocking takes a food off the list unless the request says otherwise
+			if soldOut == nil {
+				out := *availabilityRequest.Remaining_portions == 0
+				soldOut = &out
+			}
+		} else if availabilityRequest.Track_portions != nil && !*availabilityRequest.Track_portions {
+			unset = append(unset, bson.E{Key: "remaining_portions", Value: ""})
+		}
+		if soldOut != nil {
+			// The kitchen's say overrides the portion countdown's
+			set = append(set, bson.E{Key: "sold_out", Value: *soldOut}, bson.E{Key: "auto_sold_out", Value: false})
+			if *soldOut {
+				set = append(set, bson.E{Key: "sold_out_at", Value: updatedAt})
+			}
+		}
+
+		update := bson.D{{Key: "$set", Value: set}}
+		if len(unset) > 0 {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+
+		var food models.Food
+		err := foodCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"food_id": foodId},
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&food)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food item was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food availability update failed"})
+			return
+		}
+
+		foodAvailabilityBroker.publish(food)
+		c.JSON(http.StatusOK, food)
+	}
+}
+
+// reservePortions takes the ordered quantities off the foods' remaining
+// portions. Either every food has enough left and all are taken, or none are.
+func reservePortions(ctx context.Context, quantities map[string]int) error {
+	reserved := map[string]int{}
+	for foodId, quantity := range quantities {
+		if err := reservePortion(ctx, foodId, quantity); err != nil {
+			releasePortions(ctx, reserved)
+			return err
+		}
+		reserved[foodId] = quantity
+	}
+	return nil
+}
+
+// reservePortion atomically counts down a food's remaining portions, marking
+// it sold out when none are left. Foods without a count only need to be off
+// the "86" list.
+func reservePortion(ctx context.Context, foodId string, quantity int) error {
+	var food models.Food
+	err := foodCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"food_id":            foodId,
+			"sold_out":           bson.M{"$ne": true},
+			"remaining_portions": bson.M{"$gte": quantity},
+		},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.D{
+				{Key: "remaining_portions", Value: bson.D{{Key: "$subtract", Value: bson.A{"$remaining_portions", quantity}}}},
+				{Key: "updated_at", Value: "$$NOW"},
+			}}},
+			{{Key: "$set", Value: bson.D{
+				{Key: "sold_out", Value: bson.D{{Key: "$lte", Value: bson.A{"$remaining_portions", 0}}}},
+				{Key: "auto_sold_out", Value: bson.D{{Key: "$lte", Value: bson.A{"$remaining_portions", 0}}}},
+				{Key: "sold_out_at", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$lte", Value: bson.A{"$remaining_portions", 0}}}, "$$NOW", "$sold_out_at",
+				}}}},
+			}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&food)
+	if err == nil {
+		foodAvailabilityBroker.publish(food)
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return errors.New("error occurred while reserving portions")
+	}
+
+	// Nothing was counted down: either the food is not counted, or it has run out.
+	if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+		return fmt.Errorf("food item %s was not found", foodId)
+	}
+	name := food.Food_id
+	if food.Name != nil {
+		name = *food.Name
+	}
+	if food.Sold_out {
+		return fmt.Errorf("%s is sold out", name)
+	}
+	if food.Remaining_portions != nil {
+		return fmt.Errorf("only %d portions of %s are left", *food.Remaining_portions, name)
+	}
+	return nil
+}
+
+// releasePortions gives reserved portions back, e.g. when an order could not
+// be stored after all or an item was voided. A food that sold out by running
+// out of portions is taken off the "86" list again; one the kitchen put there
+// stays on it.
+func releasePortions(ctx context.Context, quantities map[string]int) {
+	for foodId, quantity := range quantities {
+		var food models.Food
+		err := foodCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"food_id": foodId, "remaining_portions": bson.M{"$ne": nil}},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.D{
+					{Key: "sold_out", Value: bson.D{{Key: "$cond", Value: bson.A{
+						bson.D{{Key: "$eq", Value: bson.A{"$auto_sold_out", true}}}, false, "$sold_out",
+					}}}},
+					{Key: "auto_sold_out", Value: false},
+					{Key: "remaining_portions", Value: bson.D{{Key: "$add", Value: bson.A{"$remaining_portions", quantity}}}},
+					{Key: "updated_at", Value: "$$NOW"},
+				}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&food)
+		if err == nil {
+			foodAvailabilityBroker.publish(food)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// checkBundle makes sure every slot of a bundle food names existing foods
+// that are not bundles themselves, and that the food is not already part of
+// another bundle, so bundles never nest.
+func checkBundle(ctx context.Context, food models.Food) error {
+	names := map[string]bool{}
+	var foodIds []string
+	for _, slot := range food.Bundle.Slots {
+		name := strings.ToLower(strings.TrimSpace(slot.Name))
+		if names[name] {
+			return fmt.Errorf("bundle slot %s is named twice", slot.Name)
+		}
+		names[name] = true
+
+		for _, foodId := range slot.Food_ids {
+			if food.Food_id != "" && foodId == food.Food_id {
+				return errors.New("a bundle cannot contain itself")
+			}
+			if !containsString(foodIds, foodId) {
+				foodIds = append(foodIds, foodId)
+			}
+		}
+	}
+
+	result, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return errors.New("error occurred while reading the bundle's foods")
+	}
+	var components []models.Food
+	if err = result.All(ctx, &components); err != nil {
+		return errors.New("error occurred while decoding the bundle's foods")
+	}
+	found := []string{}
+	for _, component := range components {
+		if component.Bundle != nil {
+			return fmt.Errorf("food item %s is a bundle and cannot be part of another one", component.Food_id)
+		}
+		if component.Archived {
+			return fmt.Errorf("food item %s is no longer on the menu", component.Food_id)
+		}
+		found = append(found, component.Food_id)
+	}
+	for _, foodId := range foodIds {
+		if !containsString(found, foodId) {
+			return fmt.Errorf("food item %s was not found", foodId)
+		}
+	}
+
+	if food.Food_id != "" {
+		count, err := foodCollection.CountDocuments(ctx, bson.M{"bundle.slots.food_ids": food.Food_id})
+		if err != nil {
+			return errors.New("error occurred while checking the bundles")
+		}
+		if count > 0 {
+			return errors.New("the food is part of a bundle and cannot be a bundle itself")
+		}
+	}
+	return nil
+}
+
+// bundleComponents builds the order items a bundle is cooked as: one per
+// slot, with the food chosen for it, in the bundle's quantity, course and
+// seat, and with the guest's allergy details. Components are not billed; the
+// bundle's unit price is shared out over them in proportion to their own
+// prices so that reports can credit each food with its part of the sale.
+func bundleComponents(ctx context.Context, bundle models.Food, bundleItem models.OrderItem) ([]models.OrderItem, error) {
+	for name := range bundleItem.Choices {
+		found := false
+		for _, slot := range bundle.Bundle.Slots {
+			found = found || slot.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("the bundle has no %s slot", name)
+		}
+	}
+
+	var components []models.OrderItem
+	var weights []int64
+	for _, slot := range bundle.Bundle.Slots {
+		foodId := slot.Food_ids[0]
+		if choice, ok := bundleItem.Choices[slot.Name]; ok {
+			if !containsString(slot.Food_ids, choice) {
+				return nil, fmt.Errorf("food item %s cannot be chosen for the %s slot", choice, slot.Name)
+			}
+			foodId = choice
+		} else if len(slot.Food_ids) > 1 {
+			return nil, fmt.Errorf("a choice is required for the %s slot", slot.Name)
+		}
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			return nil, fmt.Errorf("food item %s of the bundle was not found", foodId)
+		}
+		if err := refreshFoodPrices(ctx, &food); err != nil {
+			return nil, err
+		}
+
+		size := *bundleItem.Size
+		if slot.Size != nil {
+			size = *slot.Size
+		}
+		price, err := priceForSize(food, size)
+		if err != nil {
+			return nil, fmt.Errorf("%s slot: %w", slot.Name, err)
+		}
+		weights = append(weights, price.Amount)
+
+		slotName, componentSize := slot.Name, size
+		component := models.OrderItem{
+			Quantity:        bundleItem.Quantity,
+			Size:            &componentSize,
+			Unit_price:      &models.Money{Currency: bundleItem.Unit_price.Currency},
+			Food_id:         &food.Food_id,
+			Order_id:        bundleItem.Order_id,
+			Course:          bundleItem.Course,
+			Seat:            bundleItem.Seat,
+			Held:            bundleItem.Held,
+			Allergy:         bundleItem.Allergy,
+			Guest_allergens: bundleItem.Guest_allergens,
+			Allergy_note:    bundleItem.Allergy_note,
+			Bundle_item_id:  &bundleItem.Order_item_id,
+			Bundle_slot:     &slotName,
+			Created_at:      bundleItem.Created_at,
+			Updated_at:      bundleItem.Updated_at,
+		}
+		component.ID = primitive.NewObjectID()
+		component.Order_item_id = component.ID.Hex()
+		components = append(components, component)
+	}
+
+	for i, share := range bundleItem.Unit_price.Allocate(weights) {
+		allocated := share
+		components[i].Allocated_price = &allocated
+	}
+	return components, nil
+}
+
+// voidBundleComponents voids the components of a voided bundle with the same
+// details and puts their ingredients back into stock.
+func voidBundleComponents(ctx context.Context, bundleItemId string, updateObj bson.D) {
+	filter := bson.M{"bundle_item_id": bundleItemId, "voided": bson.M{"$ne": true}}
+	cursor, err := orderItemCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("components of bundle", bundleItemId, "were not voided:", err)
+		return
+	}
+	var components []models.OrderItem
+	if err = cursor.All(ctx, &components); err != nil {
+		log.Println("components of bundle", bundleItemId, "were not voided:", err)
+		return
+	}
+	if _, err := orderItemCollection.UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}); err != nil {
+		log.Println("components of bundle", bundleItemId, "were not voided:", err)
+		return
+	}
+	for _, component := range components {
+		releaseVoidedItem(ctx, component)
+	}
+}
+
+// GetFoodSalesReport totals, per food, the quantity sold and the revenue taken
+// between "from" and "to". Bundles are credited to the foods they are made
+// of, each with its allocated share of the bundle's price, so a burger sold
+// in a combo counts towards the burger.
+func GetFoodSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		match := bson.M{"voided": bson.M{"$ne": true}, "bundle": bson.M{"$ne": true}}
+		createdAt, err := periodFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(createdAt) > 0 {
+			match["created_at"] = createdAt
+		}
+
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$food_id"},
+			{Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$quantity"}}},
+			{Key: "bundled_quantity", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$bundle_item_id", false}}}, "$quantity", 0,
+			}}}}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$multiply", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$allocated_price.amount", "$unit_price.amount"}}},
+				"$quantity",
+			}}}}}},
+			{Key: "currency", Value: bson.D{{Key: "$first", Value: "$unit_price.currency"}}},
+		}}}
+		lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "food"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "food_id"},
+			{Key: "as", Value: "food"},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "food_id", Value: "$_id"},
+			{Key: "food_name", Value: bson.D{{Key: "$first", Value: "$food.name"}}},
+			{Key: "quantity", Value: 1},
+			{Key: "bundled_quantity", Value: 1},
+			{Key: "revenue", Value: bson.D{
+				{Key: "amount", Value: "$revenue"},
+				{Key: "currency", Value: "$currency"},
+			}},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "revenue.amount", Value: -1}, {Key: "food_id", Value: 1}}}}
+
+		result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: match}}, groupStage, lookupFoodStage, projectStage, sortStage,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while building the food sales report"})
+			return
+		}
+
+		report := []bson.M{}
+		if err = result.All(ctx, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the food sales report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
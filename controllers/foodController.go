@@ -6,9 +6,9 @@ import (
 	"golang-Hotel_Management/database"
 	"golang-Hotel_Management/models"
 	"log"
-	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,14 +16,21 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Connect to the "food" collection in MongoDB
 var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
 var validate = validator.New()
 
-// / GetFoods returns a paginated list of all food items in the collection.
+func init() {
+	// "allergen" accepts one of the 14 declared allergens
+	validate.RegisterValidation("allergen", func(fl validator.FieldLevel) bool {
+		return models.IsAllergen(fl.Field().String())
+	})
+}
+
+// / GetFoods returns a paginated list of the food items matching the search,
+// filter and sort parameters described on CatalogueQuery.
 // It uses MongoDB's aggregation framework to return total count and sliced records.
 func GetFoods() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -45,12 +52,29 @@ func GetFoods() gin.HandlerFunc {
 
 		// Calculate start index for pagination
 		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(c.Query("startIndex")) // Optional override
+		if override, err := strconv.Atoi(c.Query("startIndex")); err == nil && override >= 0 {
+			startIndex = override // Optional override
+		}
 
 		// MongoDB Aggregation Stages
 
-		// 1. Match stage (currently matches all documents)
-		matchStage := bson.D{{Key: "$match", Value: bson.D{}}}
+		// 1. Search, filter and sort stages shared with GetMenus
+		query, err := parseCatalogueQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		languages, err := requestLanguages(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		searchStages, err := foodPipeline(ctx, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		searchStages = append(searchStages, localizeStage(languages))
 
 		// 2. Group all documents and push them into a "data" array while counting
 		groupStage := bson.D{{
@@ -71,9 +95,7 @@ func GetFoods() gin.HandlerFunc {
 		}}
 
 		// Execute aggregation pipeline
-		result, err := foodCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
-		})
+		result, err := foodCollection.Aggregate(ctx, append(searchStages, groupStage, projectStage))
 		defer cancel()
 
 		// Handle aggregation error
@@ -88,11 +110,37 @@ func GetFoods() gin.HandlerFunc {
 			log.Fatal(err)
 		}
 
+		// Nothing matched the filters
+		if len(allFoods) == 0 {
+			c.JSON(http.StatusOK, gin.H{"total_count": 0, "food_items": []bson.M{}})
+			return
+		}
+
 		// Return the first (and only) item in response: total_count + food_items
+		c.Header("Vary", "Accept-Language")
 		c.JSON(http.StatusOK, allFoods[0])
 	}
 }
 
+// checkDietaryTags refuses dietary tags that the food's own allergens
+// contradict, such as a gluten-free dish declaring gluten.
+func checkDietaryTags(allergens, tags []string) error {
+	animal := []string{"MILK", "EGGS", "FISH", "CRUSTACEANS", "MOLLUSCS"}
+	seafood := []string{"FISH", "CRUSTACEANS", "MOLLUSCS"}
+
+	for _, tag := range tags {
+		for _, allergen := range allergens {
+			switch {
+			case tag == "GLUTEN_FREE" && allergen == "GLUTEN",
+				tag == "VEGAN" && containsString(animal, allergen),
+				tag == "VEGETARIAN" && containsString(seafood, allergen):
+				return fmt.Errorf("a %s food cannot contain %s", strings.ToLower(strings.ReplaceAll(tag, "_", "-")), allergen)
+			}
+		}
+	}
+	return nil
+}
+
 // GetFood retrieves a single food item by its ID
 // GetFood handles HTTP GET requests to retrieve a single food item by its food_id.
 // It returns a JSON response with the food item if found, or an error message if not.
@@ -121,6 +169,16 @@ func GetFood() gin.HandlerFunc {
 			return
 		}
 
+		// Put the name and description in the language the guest reads
+		languages, err := requestLanguages(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		localizeFood(&food, languages)
+		c.Header("Content-Language", food.Language)
+		c.Header("Vary", "Accept-Language")
+
 		// If successful, return the food item as a JSON response with HTTP 200 OK status
 		c.JSON(http.StatusOK, food)
 	}
@@ -146,6 +204,14 @@ func CreateFood() gin.HandlerFunc {
 			return
 		}
 
+		// Key translations by their canonical language tags before validating them
+		translations, err := normalizeTranslations(food.Translations)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		food.Translations = translations
+
 		// Validate the 'food' struct fields using validator rules defined in the model
 		// If validation fails, return 400 Bad Request with validation errors
 		validationErr := validate.Struct(food)
@@ -153,9 +219,30 @@ func CreateFood() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 			return
 		}
+		if err := checkDietaryTags(food.Allergens, food.Dietary_tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// The creator is the author of the food's first price
+		if food.Created_by == nil || *food.Created_by == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "created_by is required"})
+			return
+		}
+		// New foods for a menu being drafted are added to the draft
+		if status, err := checkMenuEditable(ctx, *food.Menu_id); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		// A bundle's slots must offer existing, single foods
+		if food.Bundle != nil {
+			if err := checkBundle(ctx, food); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
 		// Query the 'menu' collection to ensure the provided Menu_id exists
 		// This ensures referential integrity (food must belong to a valid menu)
-		err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
+		err = menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
 		defer cancel()
 
 		// If menu was not found, return 500 Internal Server Error with appropriate message
@@ -169,15 +256,23 @@ func CreateFood() gin.HandlerFunc {
 		food.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
+		// Images are only ever set by an upload, never by a pasted URL
+		food.Food_image = nil
+		food.Images = nil
+
 		// Generate a new ObjectID for MongoDB (_id) and assign it
 		food.ID = primitive.NewObjectID()
 
 		// Convert the generated ObjectID to a string and assign to 'Food_id' (used in API)
 		food.Food_id = food.ID.Hex()
 
-		// Round the food price to 2 decimal places using the toFixed helper function
-		var num = toFixed(*food.Price, 2)
-		food.Price = &num
+		// Prices are exact minor units; make sure they are in the restaurant's currency
+		if err := normalizeFoodPrices(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		food.Price_effective_from = &food.Created_at
 
 		// Insert the validated and completed food item into the MongoDB 'food' collection
 		result, insertErr := foodCollection.InsertOne(ctx, food)
@@ -189,28 +284,61 @@ func CreateFood() gin.HandlerFunc {
 			return
 		}
 
+		// The first price opens the food's price history
+		if err := recordInitialPrice(ctx, food); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "price history was not started"})
+			return
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, result)
 	}
 }
 
-// round helps round a float to the nearest integer
-func round(num float64) int {
-	// math.Copysign ensures correct rounding direction based on the sign of the number.
-	// e.g., round(2.3) = 2, round(2.7) = 3, round(-2.3) = -2, round(-2.7) = -3
-	return int(num + math.Copysign(0.5, num))
-}
+// normalizeFoodPrices fills in the default currency where a price has none and
+// rejects prices in any other currency, so that order totals can be summed.
+func normalizeFoodPrices(food *models.Food) error {
+	normalize := func(price models.Money) (models.Money, error) {
+		if price.Currency == "" {
+			price.Currency = models.DefaultCurrency
+		}
+		if price.Currency != models.DefaultCurrency {
+			return price, fmt.Errorf("prices must be in %s, got %s", models.DefaultCurrency, price.Currency)
+		}
+		return price, nil
+	}
 
-// toFixed limits a float value to a specific precision
-func toFixed(num float64, precision int) float64 {
-	// Calculate 10 raised to the power of 'precision'
-	output := math.Pow(10, float64(precision))
+	if food.Price != nil {
+		price, err := normalize(*food.Price)
+		if err != nil {
+			return err
+		}
+		food.Price = &price
+	}
+	for size, price := range food.Size_prices {
+		price, err := normalize(price)
+		if err != nil {
+			return err
+		}
+		food.Size_prices[size] = price
+	}
+	return nil
+}
 
-	// Multiply number to shift decimal, round it, then shift back
-	return float64(round(num*output)) / output
+// priceForSize returns the unit price of a food item for the given portion size.
+// A per-size price wins when one is set; otherwise the regular price is used.
+func priceForSize(food models.Food, size string) (models.Money, error) {
+	if price, ok := food.Size_prices[size]; ok {
+		return price, nil
+	}
+	if food.Price == nil {
+		return models.Money{}, fmt.Errorf("food item %s has no price", food.Food_id)
+	}
+	return *food.Price, nil
 }
 
-// UpdateFood modifies an existing food item
+// UpdateFood modifies an existing food item. New foods are only created by
+// CreateFood, which starts their price history.
 func UpdateFood() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -226,16 +354,105 @@ func UpdateFood() gin.HandlerFunc {
 			return
 		}
 
+		var current models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&current); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if current.Archived {
+			c.JSON(http.StatusConflict, gin.H{"error": "food is no longer on the menu"})
+			return
+		}
+
+		// Foods of a menu being drafted, or moved into one, are changed in the draft
+		menuIds := []*string{food.Menu_id, current.Menu_id}
+		for _, menuId := range menuIds {
+			if menuId == nil {
+				continue
+			}
+			if status, err := checkMenuEditable(ctx, *menuId); err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		var updateObj primitive.D
 
 		if food.Name != nil {
 			updateObj = append(updateObj, bson.E{Key: "name", Value: food.Name})
 		}
-		if food.Price != nil {
-			updateObj = append(updateObj, bson.E{Key: "price", Value: food.Price})
+		if food.Description != nil {
+			if err := validate.Var(*food.Description, "max=1000"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "description", Value: food.Description})
 		}
-		if food.Food_image != nil {
-			updateObj = append(updateObj, bson.E{Key: "food_image", Value: food.Food_image})
+		if food.Translations != nil {
+			// The translations sent replace all of the food's translations
+			translations, err := normalizeTranslations(food.Translations)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := validate.Var(translations, "dive"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "translations", Value: translations})
+		}
+		if food.Price != nil || food.Size_prices != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "prices are changed through /foods/:food_id/prices so that they are kept in the price history"})
+			return
+		}
+		if food.Food_image != nil || food.Images != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "images are changed by uploading to /foods/:food_id/image"})
+			return
+		}
+		if food.Tax_category != nil {
+			updateObj = append(updateObj, bson.E{Key: "tax_category", Value: food.Tax_category})
+		}
+		if food.Allergens != nil || food.Dietary_tags != nil {
+			if err := validate.StructPartial(food, "Allergens", "Dietary_tags"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Tags and allergens are checked together, whichever of them changed
+			var existing models.Food
+			if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&existing); err == nil {
+				if food.Allergens == nil {
+					food.Allergens = existing.Allergens
+				}
+				if food.Dietary_tags == nil {
+					food.Dietary_tags = existing.Dietary_tags
+				}
+			}
+			if err := checkDietaryTags(food.Allergens, food.Dietary_tags); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "allergens", Value: food.Allergens})
+			updateObj = append(updateObj, bson.E{Key: "dietary_tags", Value: food.Dietary_tags})
+		}
+		if food.Nutrition != nil {
+			if err := validate.Struct(food.Nutrition); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "nutrition", Value: food.Nutrition})
+		}
+		if food.Bundle != nil {
+			if err := validate.Struct(food.Bundle); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			food.Food_id = foodId
+			if err := checkBundle(ctx, food); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "bundle", Value: food.Bundle})
 		}
 		if food.Menu_id != nil {
 			err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
@@ -245,25 +462,20 @@ func UpdateFood() gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 				return
 			}
-			updateObj = append(updateObj, bson.E{Key: "menu", Value: food.Price})
+			updateObj = append(updateObj, bson.E{Key: "menu_id", Value: food.Menu_id})
 		}
 
 		// Update timestamp
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: food.Updated_at})
 
-		upsert := true
 		filter := bson.M{"food_id": foodId}
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
-		}
 
 		// Update food item
 		result, err := foodCollection.UpdateOne(
 			ctx,
 			filter,
 			bson.D{{Key: "$set", Value: updateObj}},
-			&opt,
 		)
 
 		if err != nil {
@@ -271,6 +483,10 @@ func UpdateFood() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
 
 		c.JSON(http.StatusOK, result)
 	}
@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/images"
+	"golang-Hotel_Management/models"
+	"golang-Hotel_Management/storage"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// imageMaxBytes is the largest upload accepted, from IMAGE_MAX_BYTES
+// (5 MB by default).
+func imageMaxBytes() int64 {
+	if value, err := strconv.ParseInt(os.Getenv("IMAGE_MAX_BYTES"), 10, 64); err == nil && value > 0 {
+		return value
+	}
+	return 5 << 20
+}
+
+// imageURL is where a stored image is served from. IMAGE_BASE_URL can point
+// at a CDN or a public bucket instead of this server's /images route.
+func imageURL(key string) string {
+	return strings.TrimRight(envString("IMAGE_BASE_URL", "/images"), "/") + "/" + key
+}
+
+// UploadFoodImage accepts a JPEG, PNG or WebP picture in the "image" field of
+// a multipart form, stores a thumbnail, card and full-size variant of it with
+// its metadata stripped, and points the food at them.
+func UploadFoodImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var food models.Food
+
+		foodId := c.Param("food_id")
+		maxBytes := imageMaxBytes()
+
+		// Leave room for the rest of the form around the file itself
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+		fileHeader, err := c.FormFile("image")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("image must be at most %d bytes", maxBytes)})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an image file is required in the \"image\" field"})
+			return
+		}
+		if fileHeader.Size > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("image must be at most %d bytes", maxBytes)})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image could not be read"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image could not be read"})
+			return
+		}
+
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		variants, err := images.Process(data)
+		if err == images.ErrUnsupportedType {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		store, err := storage.Default()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Keys are named after the upload's content, so a served image never
+		// changes and can be cached for good.
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:8])
+		uploaded := models.FoodImages{}
+		uploaded.Uploaded_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		for _, variant := range variants {
+			key := fmt.Sprintf("foods/%s/%s-%s%s", foodId, hash, variant.Name, variant.Extension)
+			if err := store.Put(ctx, key, variant.Data, variant.Content_type); err != nil {
+				deleteImages(ctx, store, uploaded.Keys)
+				log.Println("image", key, "was not stored:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "image was not stored"})
+				return
+			}
+			uploaded.Keys = append(uploaded.Keys, key)
+
+			switch variant.Name {
+			case "thumbnail":
+				uploaded.Thumbnail = imageURL(key)
+			case "card":
+				uploaded.Card = imageURL(key)
+			case "full":
+				uploaded.Full = imageURL(key)
+			}
+		}
+
+		_, err = foodCollection.UpdateOne(ctx, bson.M{"food_id": foodId}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "images", Value: uploaded},
+			{Key: "food_image", Value: uploaded.Full},
+			{Key: "updated_at", Value: uploaded.Uploaded_at},
+		}}})
+		if err != nil {
+			deleteImages(ctx, store, uploaded.Keys)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food image update failed"})
+			return
+		}
+
+		// The previous upload is no longer referenced; the same picture
+		// uploaded again keeps its keys.
+		if food.Images != nil {
+			var replaced []string
+			for _, key := range food.Images.Keys {
+				if !containsString(uploaded.Keys, key) {
+					replaced = append(replaced, key)
+				}
+			}
+			deleteImages(ctx, store, replaced)
+		}
+
+		c.JSON(http.StatusOK, uploaded)
+	}
+}
+
+// deleteImages removes stored images, logging what could not be removed.
+func deleteImages(ctx context.Context, store storage.Store, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Println("image", key, "was not deleted:", err)
+		}
+	}
+}
+
+// ServeImage streams a stored image. Image keys change whenever the picture
+// does, so browsers and proxies are told to keep them for a year.
+func ServeImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		key, err := storage.CleanKey(strings.TrimPrefix(c.Param("key"), "/"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image was not found"})
+			return
+		}
+
+		store, err := storage.Default()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		object, err := store.Get(ctx, key)
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading the image"})
+			return
+		}
+		defer object.Body.Close()
+
+		// The image must still exist for a cached copy to stay valid
+		etag := `"` + strings.TrimSuffix(path.Base(key), path.Ext(key)) + `"`
+		if c.GetHeader("If-None-Match") == etag {
+			c.Header("ETag", etag)
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		headers := map[string]string{
+			"Cache-Control": "public, max-age=31536000, immutable",
+			"ETag":          etag,
+		}
+		if !object.Last_modified.IsZero() {
+			headers["Last-Modified"] = object.Last_modified.UTC().Format(http.TimeFormat)
+		}
+		contentType := object.Content_type
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		c.DataFromReader(http.StatusOK, object.Size, contentType, object.Body, headers)
+	}
+}
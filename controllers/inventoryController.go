@@ -0,0 +1,608 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ingredientCollection *mongo.Collection = database.OpenCollection(database.Client, "ingredient")
+var recipeCollection *mongo.Collection = database.OpenCollection(database.Client, "recipe")
+var stockMovementCollection *mongo.Collection = database.OpenCollection(database.Client, "stockMovement")
+var stockAlertCollection *mongo.Collection = database.OpenCollection(database.Client, "stockAlert")
+
+// StockMovementRequest is the body of RecordStockMovement. For a COUNT the
+// quantity is the stock counted on the shelf; DELIVERY and WASTE take a
+// positive quantity that is added or removed; an ADJUSTMENT is a signed
+// change and needs a reason.
+type StockMovementRequest struct {
+	Type     *string  `json:"type" validate:"required,eq=COUNT|eq=DELIVERY|eq=WASTE|eq=ADJUSTMENT"`
+	Quantity *float64 `json:"quantity" validate:"required"`
+	Reason   *string  `json:"reason"`
+	Staff_id *string  `json:"staff_id" validate:"required"`
+}
+
+// GetIngredients lists the ingredient catalogue; "low_stock=true" keeps only
+// ingredients at or below their threshold.
+func GetIngredients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if c.Query("low_stock") == "true" {
+			filter["low_stock"] = true
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+		result, err := ingredientCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing ingredients"})
+			return
+		}
+
+		ingredients := []models.Ingredient{}
+		if err = result.All(ctx, &ingredients); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding ingredients"})
+			return
+		}
+
+		c.JSON(http.StatusOK, ingredients)
+	}
+}
+
+func GetIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var ingredient models.Ingredient
+
+		ingredientId := c.Param("ingredient_id")
+		if err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": ingredientId}).Decode(&ingredient); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ingredient was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+// CreateIngredient adds an ingredient to the catalogue. Any stock it starts
+// with is recorded in the ledger as an opening count.
+func CreateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var ingredient models.Ingredient
+
+		if err := c.BindJSON(&ingredient); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(ingredient)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if ingredient.Stock_on_hand < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stock_on_hand cannot be negative"})
+			return
+		}
+
+		openingStock := ingredient.Stock_on_hand
+		ingredient.Stock_on_hand = 0
+		ingredient.Low_stock = false
+		ingredient.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		ingredient.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		ingredient.ID = primitive.NewObjectID()
+		ingredient.Ingredient_id = ingredient.ID.Hex()
+
+		result, insertErr := ingredientCollection.InsertOne(ctx, ingredient)
+		if insertErr != nil {
+			msg := fmt.Sprintf("Ingredient was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		reason := "opening stock"
+		movement := models.StockMovement{
+			Ingredient_id: ingredient.Ingredient_id,
+			Type:          "COUNT",
+			Quantity:      openingStock,
+			Reason:        &reason,
+		}
+		if _, err := moveStock(ctx, movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// UpdateIngredient changes an ingredient's details. Stock on hand is left to
+// RecordStockMovement so that every change reaches the ledger.
+func UpdateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var ingredient models.Ingredient
+		var existing models.Ingredient
+
+		ingredientId := c.Param("ingredient_id")
+		filter := bson.M{"ingredient_id": ingredientId}
+
+		if err := c.BindJSON(&ingredient); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := ingredientCollection.FindOne(ctx, filter).Decode(&existing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ingredient was not found"})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if ingredient.Name != nil {
+			if err := validate.Var(*ingredient.Name, "min=2,max=100"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "name", Value: ingredient.Name})
+		}
+		if ingredient.Unit != nil {
+			if err := validate.Var(*ingredient.Unit, "eq=g|eq=kg|eq=ml|eq=l|eq=pcs"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "unit", Value: ingredient.Unit})
+		}
+		if ingredient.Low_stock_threshold != nil {
+			if err := validate.Var(*ingredient.Low_stock_threshold, "min=0"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			existing.Low_stock_threshold = ingredient.Low_stock_threshold
+			updateObj = append(updateObj, bson.E{Key: "low_stock_threshold", Value: ingredient.Low_stock_threshold})
+		}
+
+		ingredient.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: ingredient.Updated_at})
+
+		result, err := ingredientCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+		if err != nil {
+			msg := "Ingredient update failed"
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// A new threshold can raise or resolve an alert without stock moving.
+		if err := checkLowStock(ctx, existing, existing.Stock_on_hand); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// RecordStockMovement records a count, delivery, waste or adjustment against
+// an ingredient and returns the ledger entry.
+func RecordStockMovement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request StockMovementRequest
+
+		ingredientId := c.Param("ingredient_id")
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(request)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		quantity := *request.Quantity
+		switch *request.Type {
+		case "COUNT":
+			if quantity < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a count cannot be negative"})
+				return
+			}
+		case "DELIVERY":
+			if quantity <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a delivery must be more than zero"})
+				return
+			}
+		case "WASTE":
+			if quantity <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "waste must be more than zero"})
+				return
+			}
+			quantity = -quantity
+		case "ADJUSTMENT":
+			if quantity == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "an adjustment cannot be zero"})
+				return
+			}
+			if request.Reason == nil || *request.Reason == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "an adjustment needs a reason"})
+				return
+			}
+		}
+
+		movement, err := moveStock(ctx, models.StockMovement{
+			Ingredient_id: ingredientId,
+			Type:          *request.Type,
+			Quantity:      quantity,
+			Reason:        request.Reason,
+			Staff_id:      request.Staff_id,
+		})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ingredient was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, movement)
+	}
+}
+
+// GetStockMovements returns an ingredient's ledger, newest first, optionally
+// limited to the "from" and "to" period (RFC3339).
+func GetStockMovements() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"ingredient_id": c.Param("ingredient_id")}
+		period, err := periodFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(period) > 0 {
+			filter["created_at"] = period
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+		result, err := stockMovementCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing stock movements"})
+			return
+		}
+
+		movements := []models.StockMovement{}
+		if err = result.All(ctx, &movements); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding stock movements"})
+			return
+		}
+
+		c.JSON(http.StatusOK, movements)
+	}
+}
+
+// GetStockAlerts lists low-stock alerts. "status" is "open" (the default),
+// "resolved" or "all".
+func GetStockAlerts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		switch c.DefaultQuery("status", "open") {
+		case "open":
+			filter["resolved_at"] = nil
+		case "resolved":
+			filter["resolved_at"] = bson.M{"$ne": nil}
+		case "all":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, resolved or all"})
+			return
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "raised_at", Value: -1}})
+		result, err := stockAlertCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing stock alerts"})
+			return
+		}
+
+		alerts := []models.StockAlert{}
+		if err = result.All(ctx, &alerts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding stock alerts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, alerts)
+	}
+}
+
+func GetRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var recipe models.Recipe
+
+		foodId := c.Param("food_id")
+		if err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&recipe); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recipe was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+// SetRecipe replaces the recipe of a food with the ingredients given.
+func SetRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var recipe models.Recipe
+		var existing models.Recipe
+
+		foodId := c.Param("food_id")
+
+		if err := c.BindJSON(&recipe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(recipe)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		count, err := foodCollection.CountDocuments(ctx, bson.M{"food_id": foodId})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		var ingredientIds []string
+		for _, line := range recipe.Ingredients {
+			if containsString(ingredientIds, *line.Ingredient_id) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ingredient %s is listed twice", *line.Ingredient_id)})
+				return
+			}
+			ingredientIds = append(ingredientIds, *line.Ingredient_id)
+		}
+		count, err = ingredientCollection.CountDocuments(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking ingredients"})
+			return
+		}
+		if int(count) != len(ingredientIds) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "one or more ingredients were not found"})
+			return
+		}
+
+		recipe.Food_id = foodId
+		recipe.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&existing); err == nil {
+			recipe.ID = existing.ID
+			recipe.Created_at = existing.Created_at
+		} else {
+			recipe.ID = primitive.NewObjectID()
+			recipe.Created_at = recipe.Updated_at
+		}
+		recipe.Recipe_id = recipe.ID.Hex()
+
+		_, err = recipeCollection.ReplaceOne(ctx, bson.M{"food_id": foodId}, recipe, options.Replace().SetUpsert(true))
+		if err != nil {
+			msg := fmt.Sprintf("Recipe was not saved")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+// moveStock applies a movement to its ingredient and writes it to the ledger.
+// A COUNT sets stock to the movement's quantity, which is then rewritten as
+// the change the count made; every other type adds its signed quantity.
+func moveStock(ctx context.Context, movement models.StockMovement) (models.StockMovement, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	change := bson.D{{Key: "$inc", Value: bson.D{{Key: "stock_on_hand", Value: movement.Quantity}}}}
+	if movement.Type == "COUNT" {
+		change = bson.D{{Key: "$set", Value: bson.D{{Key: "stock_on_hand", Value: movement.Quantity}}}}
+	}
+	change = append(change, bson.E{Key: "$currentDate", Value: bson.D{{Key: "updated_at", Value: true}}})
+
+	// The stock before the change is what makes the ledger line exact.
+	var before models.Ingredient
+	err := ingredientCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"ingredient_id": movement.Ingredient_id},
+		change,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return movement, err
+	}
+	if err != nil {
+		return movement, errors.New("error occurred while updating stock")
+	}
+
+	if movement.Type == "COUNT" {
+		movement.Balance_after = movement.Quantity
+		movement.Quantity = movement.Quantity - before.Stock_on_hand
+	} else {
+		movement.Balance_after = before.Stock_on_hand + movement.Quantity
+	}
+	movement.Created_at = now
+	movement.ID = primitive.NewObjectID()
+	movement.Movement_id = movement.ID.Hex()
+
+	if _, err := stockMovementCollection.InsertOne(ctx, movement); err != nil {
+		return movement, errors.New("stock movement was not recorded")
+	}
+
+	return movement, checkLowStock(ctx, before, movement.Balance_after)
+}
+
+// checkLowStock raises an alert when an ingredient has fallen to its
+// threshold and resolves its alerts once it is back above it. The flag on the
+// ingredient is flipped conditionally so that only one alert is raised when
+// several movements cross the threshold at once.
+func checkLowStock(ctx context.Context, ingredient models.Ingredient, stock float64) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	filter := bson.M{"ingredient_id": ingredient.Ingredient_id}
+
+	if ingredient.Low_stock_threshold != nil && stock <= *ingredient.Low_stock_threshold {
+		filter["low_stock"] = bson.M{"$ne": true}
+		result, err := ingredientCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "low_stock", Value: true}}}})
+		if err != nil {
+			return errors.New("error occurred while flagging low stock")
+		}
+		if result.ModifiedCount == 0 {
+			return nil
+		}
+
+		alert := models.StockAlert{
+			Ingredient_id: ingredient.Ingredient_id,
+			Stock_on_hand: stock,
+			Threshold:     *ingredient.Low_stock_threshold,
+			Raised_at:     now,
+		}
+		if ingredient.Name != nil {
+			alert.Name = *ingredient.Name
+		}
+		alert.ID = primitive.NewObjectID()
+		alert.Stock_alert_id = alert.ID.Hex()
+		if _, err := stockAlertCollection.InsertOne(ctx, alert); err != nil {
+			return errors.New("low stock alert was not raised")
+		}
+		log.Println("low stock:", alert.Name, "is down to", stock)
+		return nil
+	}
+
+	filter["low_stock"] = true
+	result, err := ingredientCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "low_stock", Value: false}}}})
+	if err != nil {
+		return errors.New("error occurred while clearing low stock")
+	}
+	if result.ModifiedCount == 0 {
+		return nil
+	}
+	_, err = stockAlertCollection.UpdateMany(
+		ctx,
+		bson.M{"ingredient_id": ingredient.Ingredient_id, "resolved_at": nil},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "resolved_at", Value: now}}}},
+	)
+	if err != nil {
+		return errors.New("error occurred while resolving low stock alerts")
+	}
+	return nil
+}
+
+// moveRecipeStock takes the ingredients of the given number of portions of a
+// food out of stock, or puts them back when portions is negative. Foods
+// without a recipe do not touch stock.
+func moveRecipeStock(ctx context.Context, foodId string, portions int, movementType string, orderItemId string) error {
+	var recipe models.Recipe
+	err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&recipe)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return errors.New("error occurred while reading the recipe")
+	}
+
+	for _, line := range recipe.Ingredients {
+		_, err := moveStock(ctx, models.StockMovement{
+			Ingredient_id: *line.Ingredient_id,
+			Type:          movementType,
+			Quantity:      -*line.Quantity * float64(portions),
+			Order_item_id: &orderItemId,
+		})
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	return nil
+}
+
+// depleteStock takes an order item's ingredients out of stock. The sale has
+// already been made, so stock is allowed to go negative and failures are
+// logged rather than returned.
+func depleteStock(ctx context.Context, orderItem models.OrderItem) {
+	if orderItem.Food_id == nil || orderItem.Quantity == nil {
+		return
+	}
+	if err := moveRecipeStock(ctx, *orderItem.Food_id, *orderItem.Quantity, "SALE", orderItem.Order_item_id); err != nil {
+		log.Println("stock was not depleted for order item", orderItem.Order_item_id, ":", err)
+	}
+}
+
+// restoreStock puts a voided order item's ingredients back into stock.
+func restoreStock(ctx context.Context, orderItem models.OrderItem) {
+	if orderItem.Food_id == nil || orderItem.Quantity == nil {
+		return
+	}
+	if err := moveRecipeStock(ctx, *orderItem.Food_id, -*orderItem.Quantity, "VOID", orderItem.Order_item_id); err != nil {
+		log.Println("stock was not restored for order item", orderItem.Order_item_id, ":", err)
+	}
+}
+
+// changeStock keeps stock in step with an update to an order item's food or
+// quantity.
+func changeStock(ctx context.Context, existing, update models.OrderItem) {
+	if existing.Food_id == nil || existing.Quantity == nil || existing.Voided {
+		return
+	}
+
+	foodId, quantity := *existing.Food_id, *existing.Quantity
+	if update.Food_id != nil {
+		foodId = *update.Food_id
+	}
+	if update.Quantity != nil {
+		quantity = *update.Quantity
+	}
+
+	var err error
+	if foodId == *existing.Food_id {
+		if quantity != *existing.Quantity {
+			err = moveRecipeStock(ctx, foodId, quantity-*existing.Quantity, "ORDER_CHANGE", existing.Order_item_id)
+		}
+	} else {
+		err = moveRecipeStock(ctx, *existing.Food_id, -*existing.Quantity, "ORDER_CHANGE", existing.Order_item_id)
+		if err == nil {
+			err = moveRecipeStock(ctx, foodId, quantity, "ORDER_CHANGE", existing.Order_item_id)
+		}
+	}
+	if err != nil {
+		log.Println("stock was not changed for order item", existing.Order_item_id, ":", err)
+	}
+}
@@ -17,14 +17,32 @@ import (
 )
 
 type InvoiceViewFormat struct {
-	Invoice_id       string      `json:"invoice_id"`
-	Payment_method   string      `json:"payment_method"`
-	Order_id         string      `json:"order_id"`
-	Payment_status   *string     `json:"payment_status"`
-	Payment_due      interface{} `json:"payment_due"`
-	Table_number     interface{} `json:"table_number"`
-	Payment_due_date time.Time   `json:"payment_due_date"`
-	Order_details    interface{} `json:"order_details"`
+	Invoice_id         string                   `json:"invoice_id"`
+	Invoice_number     string                   `json:"invoice_number"`
+	Payment_method     string                   `json:"payment_method"`
+	Order_id           string                   `json:"order_id"`
+	Payment_status     *string                  `json:"payment_status"`
+	Payment_due        models.Money             `json:"payment_due"`
+	Table_number       interface{}              `json:"table_number"`
+	Payment_due_date   time.Time                `json:"payment_due_date"`
+	Order_details      []models.InvoiceLine     `json:"order_details"`
+	Subtotal           models.Money             `json:"subtotal"`
+	Discounts          []models.InvoiceDiscount `json:"discounts"`
+	Service_charge     models.Money             `json:"service_charge"`
+	Taxes              []models.TaxLine         `json:"taxes"`
+	Delivery_fee       models.Money             `json:"delivery_fee"`
+	Grand_total        models.Money             `json:"grand_total"`
+	Prices_include_tax bool                     `json:"prices_include_tax"`
+	Amount_paid        models.Money             `json:"amount_paid"`
+	Balance_due        models.Money             `json:"balance_due"`
+}
+
+// CreateInvoiceRequest is the body of CreateInvoice. Amounts are never taken
+// from the client: the invoice is priced from the order's items on the server.
+type CreateInvoiceRequest struct {
+	Order_id       string                   `json:"order_id" validate:"required"`
+	Payment_method *string                  `json:"payment_method" validate:"omitempty,eq=CARD|eq=CASH"`
+	Discounts      []models.InvoiceDiscount `json:"discounts" validate:"dive"`
 }
 
 var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
@@ -92,15 +110,6 @@ func GetInvoice() gin.HandlerFunc {
 		// Declare a variable to store the formatted invoice view for the response
 		var invoiceView InvoiceViewFormat
 
-		// Call helper function to fetch all items associated with the order in this invoice
-		allOrderItems, err := ItemsByOrder(invoice.Order_id)
-
-		// If fetching order items fails, return an error response
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while retrieving order items"})
-			return
-		}
-
 		// Begin building the custom invoice view for client-friendly response
 
 		// Set the order ID in the invoice view
@@ -119,63 +128,305 @@ func GetInvoice() gin.HandlerFunc {
 
 		// Set other invoice fields in the view
 		invoiceView.Invoice_id = invoice.Invoice_id
+		invoiceView.Invoice_number = invoice.Invoice_number
 		invoiceView.Payment_status = invoice.Payment_status
 
-		// Set payment due, table number, and order details from the order items slice
-		invoiceView.Payment_due = allOrderItems[0]["payment_due"]
-		invoiceView.Table_number = allOrderItems[0]["table_number"]
-		invoiceView.Order_details = allOrderItems[0]["order_items"]
+		// Set the price breakdown stored when the invoice was issued, so the view
+		// does not change when food prices change later
+		invoiceView.Payment_due = invoice.Payment_due
+		invoiceView.Table_number = invoice.Table_number
+		invoiceView.Order_details = invoice.Line_items
+		invoiceView.Subtotal = invoice.Subtotal
+		invoiceView.Discounts = invoice.Discounts
+		invoiceView.Service_charge = invoice.Service_charge
+		invoiceView.Taxes = invoice.Taxes
+		invoiceView.Delivery_fee = invoice.Delivery_fee
+		invoiceView.Grand_total = invoice.Grand_total
+		invoiceView.Amount_paid = invoice.Amount_paid
+		invoiceView.Balance_due = invoice.Balance_due
+		invoiceView.Prices_include_tax = invoice.Prices_include_tax
 
 		// Return the formatted invoice data as JSON with 200 OK status
 		c.JSON(http.StatusOK, invoiceView)
 	}
 }
 
+// CreateInvoice issues an invoice for an order. The line items, subtotal,
+// discounts, service charge, taxes and grand total are all computed here from
+// the order's (non-voided) items and stored on the invoice.
 func CreateInvoice() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoiceRequest CreateInvoiceRequest
 		var invoice models.Invoice
 
-		if err := c.BindJSON(&invoice); err != nil {
+		if err := c.BindJSON(&invoiceRequest); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		validationErr := validate.Struct(invoiceRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
 		var order models.Order
-		err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order)
-		defer cancel()
+		err := orderCollection.FindOne(ctx, bson.M{"order_id": invoiceRequest.Order_id}).Decode(&order)
 		if err != nil {
 			msg := fmt.Sprintf("message: Order was not found")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
 
-		status := "PENDING"
-		if invoice.Payment_status == nil {
-			invoice.Payment_status = &status
+		// An order is billed once, either whole or through a split.
+		if err := checkOrderNotInvoiced(ctx, order.Order_id); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
 		}
 
-		invoice.Payment_due_date, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
-		invoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		invoice.ID = primitive.NewObjectID()
-		invoice.Invoice_id = invoice.ID.Hex()
+		lines, err := invoiceLinesForOrder(ctx, order.Order_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while retrieving order items"})
+			return
+		}
+		if len(lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order has no billable items"})
+			return
+		}
 
-		validationErr := validate.Struct(invoice)
-		if validationErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		restaurant, rates, err := invoicePricingSetup(ctx, order)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		result, insertErr := invoiceCollection.InsertOne(ctx, invoice)
-		if insertErr != nil {
+		priceInvoice(&invoice, lines, invoiceRequest.Discounts, order, restaurant, rates)
+		newInvoice(ctx, &invoice, order, invoiceRequest.Payment_method)
+
+		invoices := []models.Invoice{invoice}
+		if _, insertErr := issueInvoices(ctx, restaurant, invoices); mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("order %s has already been invoiced", order.Order_id)})
+			return
+		} else if insertErr != nil {
 			msg := fmt.Sprintf("invoice item was not created")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
-		defer cancel()
-		c.JSON(http.StatusOK, result)
+		c.JSON(http.StatusOK, gin.H{"InsertedID": invoice.ID, "invoice_number": invoices[0].Invoice_number})
+	}
+}
+
+// EnsureInvoiceIndexes lets an order be billed only once: among the invoices
+// that are not voided, at most one per order is either the whole bill (part
+// 0) or the first part of a split, whose other parts are issued with it. Two
+// concurrent requests cannot both get past checkOrderNotInvoiced and bill the
+// order twice. It is called once at startup.
+func EnsureInvoiceIndexes(ctx context.Context) error {
+	_, err := invoiceCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "order_id", Value: 1}},
+		Options: options.Index().
+			SetName("order_billed_once").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"voided": false, "split_part": bson.M{"$lte": 1}}),
+	})
+	if err != nil {
+		return fmt.Errorf("billed order index: %w", err)
+	}
+	return nil
+}
+
+// checkOrderNotInvoiced fails when the order already has an invoice that was
+// not voided.
+func checkOrderNotInvoiced(ctx context.Context, orderId string) error {
+	count, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": orderId, "voided": bson.M{"$ne": true}})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("order %s has already been invoiced", orderId)
+	}
+	return nil
+}
+
+// invoicePricingSetup loads the restaurant settings and the tax rates in effect
+// now, which together with the order's lines decide what the invoice costs.
+func invoicePricingSetup(ctx context.Context, order models.Order) (models.Restaurant, map[string]models.TaxRate, error) {
+	restaurant, err := restaurantForOrder(ctx, order.Restaurant_id)
+	if err != nil {
+		return restaurant, nil, fmt.Errorf("message: Restaurant was not found")
+	}
+
+	rates, err := taxRatesAt(ctx, time.Now())
+	if err != nil {
+		return restaurant, nil, fmt.Errorf("error occurred while loading tax rates")
+	}
+	return restaurant, rates, nil
+}
+
+// newInvoice fills in the identity, links and dates of a priced invoice.
+func newInvoice(ctx context.Context, invoice *models.Invoice, order models.Order, paymentMethod *string) {
+	invoice.Order_id = order.Order_id
+	invoice.Payment_method = paymentMethod
+	invoice.Table_number = tableNumber(ctx, order.Table_id)
+
+	status := "PENDING"
+	invoice.Payment_status = &status
+	invoice.Amount_paid = models.Money{Currency: invoice.Payment_due.Currency}
+	invoice.Balance_due = invoice.Payment_due
+
+	invoice.Payment_due_date, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
+	invoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	invoice.ID = primitive.NewObjectID()
+	invoice.Invoice_id = invoice.ID.Hex()
+}
+
+// tableNumber returns the number of the table an order was placed at, as the
+// guests know it, or nil for orders without a table.
+func tableNumber(ctx context.Context, tableId *string) interface{} {
+	if tableId == nil {
+		return nil
+	}
+	var table bson.M
+	err := tableCollection.FindOne(ctx, bson.M{"table_id": *tableId},
+		options.FindOne().SetProjection(bson.M{"table_number": 1})).Decode(&table)
+	if err != nil {
+		return nil
+	}
+	return table["table_number"]
+}
+
+// invoiceLinesForOrder reads the billable items of an order together with the
+// name of their food. Voided items are left out, and so are the components
+// of bundles, which are billed at the bundle's price.
+func invoiceLinesForOrder(ctx context.Context, orderId string) ([]models.InvoiceLine, error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "order_id", Value: orderId},
+		{Key: "voided", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "bundle_item_id", Value: nil},
+	}}}
+	lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "food"},
+		{Key: "localField", Value: "food_id"},
+		{Key: "foreignField", Value: "food_id"},
+		{Key: "as", Value: "food"},
+	}}}
+	unwindFoodStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$food"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "order_item_id", Value: 1},
+		{Key: "food_id", Value: 1},
+		{Key: "name", Value: "$food.name"},
+		{Key: "tax_category", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$food.tax_category", DefaultTaxCategory}}}},
+		{Key: "size", Value: 1},
+		{Key: "quantity", Value: 1},
+		{Key: "seat", Value: 1},
+		{Key: "unit_price", Value: 1},
+	}}}
+
+	result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+		matchStage, lookupFoodStage, unwindFoodStage, projectStage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []models.InvoiceLine
+	if err = result.All(ctx, &lines); err != nil {
+		return nil, err
+	}
+	for i := range lines {
+		lines[i].Amount = lines[i].Unit_price.Mul(lines[i].Quantity)
+	}
+	return lines, nil
+}
+
+// priceInvoice fills in the totals of an invoice from its lines. Discounts come
+// off the subtotal first and are shared out over the tax categories in
+// proportion to their sales; the service charge is worked out on what is left.
+// Each category is then taxed at the rate in effect, either on top of the price
+// or, for tax-inclusive restaurants, out of it. Any delivery fee is added last.
+func priceInvoice(invoice *models.Invoice, lines []models.InvoiceLine, discounts []models.InvoiceDiscount, order models.Order, restaurant models.Restaurant, rates map[string]models.TaxRate) {
+	invoice.Line_items = lines
+	invoice.Restaurant_id = restaurant.Restaurant_id
+	invoice.Prices_include_tax = *restaurant.Prices_include_tax
+
+	// Sales per tax category, in the order the categories first appear
+	var categories []string
+	byCategory := map[string]models.Money{}
+
+	invoice.Subtotal = models.NewMoney(0)
+	for _, line := range lines {
+		invoice.Subtotal = invoice.Subtotal.Add(line.Amount)
+		if _, ok := byCategory[line.Tax_category]; !ok {
+			categories = append(categories, line.Tax_category)
+			byCategory[line.Tax_category] = models.NewMoney(0)
+		}
+		byCategory[line.Tax_category] = byCategory[line.Tax_category].Add(line.Amount)
+	}
+
+	net := invoice.Subtotal
+	invoice.Discounts = []models.InvoiceDiscount{}
+	for _, discount := range discounts {
+		if discount.Percentage != nil {
+			discount.Amount = invoice.Subtotal.MulRate(*discount.Percentage / 100)
+		}
+		// A discount can never take the bill below zero.
+		discount.Amount = discount.Amount.Min(net)
+		discount.Amount.Currency = net.Currency
+		net = net.Sub(discount.Amount)
+		invoice.Discounts = append(invoice.Discounts, discount)
+	}
+
+	weights := make([]int64, len(categories))
+	for i, category := range categories {
+		weights[i] = byCategory[category].Amount
+	}
+	for i, share := range invoice.Subtotal.Sub(net).Allocate(weights) {
+		byCategory[categories[i]] = byCategory[categories[i]].Sub(share)
+	}
+
+	invoice.Service_charge = models.NewMoney(0)
+	if order.Order_type == "" || order.Order_type == "DINE_IN" {
+		invoice.Service_charge = net.MulRate(*restaurant.Service_charge_rate)
+	}
+	if !invoice.Service_charge.IsZero() {
+		categories = append(categories, ServiceTaxCategory)
+		byCategory[ServiceTaxCategory] = invoice.Service_charge
+	}
+
+	taxTotal := models.NewMoney(0)
+	invoice.Taxes = []models.TaxLine{}
+	for _, category := range categories {
+		rate, ok := rates[category]
+		if !ok || *rate.Rate == 0 {
+			continue
+		}
+
+		tax := models.TaxLine{Tax_rate_id: rate.Tax_rate_id, Category: category, Name: *rate.Name, Rate: *rate.Rate}
+		if invoice.Prices_include_tax {
+			tax.Amount = byCategory[category].InclusiveTax(*rate.Rate)
+			tax.Taxable = byCategory[category].Sub(tax.Amount)
+		} else {
+			tax.Taxable = byCategory[category]
+			tax.Amount = byCategory[category].MulRate(*rate.Rate)
+		}
+		invoice.Taxes = append(invoice.Taxes, tax)
+		taxTotal = taxTotal.Add(tax.Amount)
+	}
+
+	invoice.Delivery_fee = order.Delivery_fee
+	invoice.Grand_total = net.Add(invoice.Service_charge).Add(invoice.Delivery_fee)
+	if !invoice.Prices_include_tax {
+		invoice.Grand_total = invoice.Grand_total.Add(taxTotal)
 	}
+	invoice.Payment_due = invoice.Grand_total
 }
 
 // UpdateInvoice handles PUT/PATCH requests to update an existing invoice in the database.
@@ -210,33 +461,22 @@ func UpdateInvoice() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{Key: "payment_method", Value: invoice.Payment_method})
 		}
 
-		// If Payment_status is provided, add it to the update object
+		// Payment_status is derived from the invoice's payments and cannot be set directly
 		if invoice.Payment_status != nil {
-			updateObj = append(updateObj, bson.E{Key: "payment_status", Value: invoice.Payment_status})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "payment status is derived from payments, record a payment instead"})
+			return
 		}
 
 		// Always update the 'updated_at' timestamp to the current time
 		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: invoice.Updated_at})
 
-		// Set up the update options: Upsert = true (create the document if it doesn't exist)
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
-		}
-
-		// If Payment_status is missing, default it to "PENDING"
-		status := "PENDING"
-		if invoice.Payment_status == nil {
-			invoice.Payment_status = &status
-		}
-
-		// Perform the update operation on the invoice collection
+		// Perform the update operation on the invoice collection. Invoices are
+		// only ever created numbered, by CreateInvoice, so none is upserted here.
 		result, err := invoiceCollection.UpdateOne(
 			ctx,                                     // Context
 			filter,                                  // Filter to match the invoice
 			bson.D{{Key: "$set", Value: updateObj}}, // Update document
-			&opt,                                    // Options (with upsert)
 		)
 
 		// If the update fails, return a 500 Internal Server Error
@@ -245,8 +485,92 @@ func UpdateInvoice() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
 
 		// If successful, return the update result (includes modified count, etc.)
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+// VoidInvoiceRequest is the body of VoidInvoice. Cancelling a legal document
+// needs a manager's approval.
+type VoidInvoiceRequest struct {
+	Reason      *string `json:"reason" validate:"required"`
+	Staff_id    *string `json:"staff_id" validate:"required"`
+	Manager_id  *string `json:"manager_id" validate:"required"`
+	Manager_pin *string `json:"manager_pin" validate:"required"`
+}
+
+// VoidInvoice cancels an invoice that nothing has been paid on. The invoice
+// and its number are kept, marked as voided, and the order can be invoiced
+// again. Paid invoices are corrected with a refund instead.
+func VoidInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var voidRequest VoidInvoiceRequest
+		var invoice models.Invoice
+
+		invoiceId := c.Param("invoice_id")
+
+		if err := c.BindJSON(&voidRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(voidRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if err := verifyManagerApproval(ctx, voidRequest.Manager_id, voidRequest.Manager_pin); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+
+		if invoice.Voided {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is already voided"})
+			return
+		}
+		if !invoice.Amount_paid.IsZero() {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice has payments, refund it instead"})
+			return
+		}
+
+		// Nothing may have been paid or voided since the invoice was read
+		voidedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoiceId, "voided": bson.M{"$ne": true}, "amount_paid.amount": 0},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "voided", Value: true},
+				{Key: "void_reason", Value: voidRequest.Reason},
+				{Key: "voided_by", Value: voidRequest.Staff_id},
+				{Key: "voided_at", Value: voidedAt},
+				{Key: "updated_at", Value: voidedAt},
+			}}},
+		)
+		if err != nil {
+			msg := fmt.Sprintf("invoice void failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice was paid or voided meanwhile"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FireCourseRequest is the optional body of a fire call.
+type FireCourseRequest struct {
+	Staff_id *string `json:"staff_id"`
+}
+
+// courseNumber turns a course value read back from Mongo into an int. Items
+// created before courses existed have none and belong to the first course.
+func courseNumber(value interface{}) int {
+	switch number := value.(type) {
+	case int32:
+		return int(number)
+	case int64:
+		return int(number)
+	}
+	return 1
+}
+
+// recordCourseFired stores the first time a course of an order was fired.
+// Firing the same course again keeps the original timestamp.
+func recordCourseFired(ctx context.Context, orderId string, course int, firedAt time.Time, firedBy *string) error {
+	_, err := orderCollection.UpdateOne(
+		ctx,
+		bson.M{"order_id": orderId, "course_timings.course": bson.M{"$ne": course}},
+		bson.D{{Key: "$push", Value: bson.D{{Key: "course_timings", Value: bson.D{
+			{Key: "course", Value: course},
+			{Key: "fired_at", Value: firedAt},
+			{Key: "fired_by", Value: firedBy},
+		}}}}},
+	)
+	return err
+}
+
+// FireCourse releases a held course of an order to the kitchen.
+func FireCourse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var fireRequest FireCourseRequest
+
+		orderId := c.Param("order_id")
+		course, err := strconv.Atoi(c.Param("course"))
+		if err != nil || course < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "course must be a positive number"})
+			return
+		}
+
+		// The body is optional; it only names the waiter firing the course.
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&fireRequest); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		itemFilter := bson.M{
+			"order_id": orderId,
+			"sent_at":  nil,
+			"voided":   bson.M{"$ne": true},
+		}
+		if course == 1 {
+			itemFilter["course"] = bson.M{"$in": bson.A{1, nil}}
+		} else {
+			itemFilter["course"] = course
+		}
+
+		firedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := orderItemCollection.UpdateMany(
+			ctx,
+			itemFilter,
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "held", Value: false},
+				{Key: "sent_at", Value: firedAt},
+				{Key: "updated_at", Value: firedAt},
+			}}},
+		)
+		if err != nil {
+			msg := fmt.Sprintf("course could not be fired")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no held items were found for this course"})
+			return
+		}
+
+		if err := recordCourseFired(ctx, orderId, course, firedAt, fireRequest.Staff_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "course timing was not recorded"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// ServeCourse marks a fired course as served, which takes its items off the
+// kitchen ticket feed and closes its timing.
+func ServeCourse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+		course, err := strconv.Atoi(c.Param("course"))
+		if err != nil || course < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "course must be a positive number"})
+			return
+		}
+
+		itemFilter := bson.M{
+			"order_id":  orderId,
+			"sent_at":   bson.M{"$ne": nil},
+			"served_at": nil,
+		}
+		if course == 1 {
+			itemFilter["course"] = bson.M{"$in": bson.A{1, nil}}
+		} else {
+			itemFilter["course"] = course
+		}
+
+		servedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := orderItemCollection.UpdateMany(ctx, itemFilter, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "served_at", Value: servedAt},
+			{Key: "updated_at", Value: servedAt},
+		}}})
+		if err != nil {
+			msg := fmt.Sprintf("course could not be served")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		_, err = orderCollection.UpdateOne(
+			ctx,
+			bson.M{"order_id": orderId, "course_timings.course": course},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "course_timings.$.served_at", Value: servedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "course timing was not recorded"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetKitchenTickets returns the items the kitchen should be cooking: sent,
+// not held, not voided and not yet served, grouped by order and course in the
+// order they were sent. Items for guests with an allergy are flagged, along
+// with any of the guest's allergens the food declares, and so is their ticket.
+// Bundles show up as their components, each with the slot it fills.
+func GetKitchenTickets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		matchStage := bson.D{{Key: "$match", Value: bson.D{
+			{Key: "sent_at", Value: bson.D{{Key: "$ne", Value: nil}}},
+			{Key: "served_at", Value: nil},
+			{Key: "held", Value: bson.D{{Key: "$ne", Value: true}}},
+			{Key: "voided", Value: bson.D{{Key: "$ne", Value: true}}},
+			{Key: "bundle", Value: bson.D{{Key: "$ne", Value: true}}},
+		}}}
+		lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "food"},
+			{Key: "localField", Value: "food_id"},
+			{Key: "foreignField", Value: "food_id"},
+			{Key: "as", Value: "food"},
+		}}}
+		unwindFoodStage := bson.D{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$food"},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}}
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "order_id", Value: "$order_id"},
+				{Key: "course", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$course", 1}}}},
+			}},
+			{Key: "sent_at", Value: bson.D{{Key: "$min", Value: "$sent_at"}}},
+			{Key: "items", Value: bson.D{{Key: "$push", Value: bson.D{
+				{Key: "order_item_id", Value: "$order_item_id"},
+				{Key: "food_name", Value: "$food.name"},
+				{Key: "size", Value: "$size"},
+				{Key: "quantity", Value: "$quantity"},
+				{Key: "bundle_item_id", Value: "$bundle_item_id"},
+				{Key: "bundle_slot", Value: "$bundle_slot"},
+				{Key: "allergy", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$allergy", false}}}},
+				{Key: "guest_allergens", Value: "$guest_allergens"},
+				{Key: "allergy_note", Value: "$allergy_note"},
+				{Key: "allergen_conflicts", Value: bson.D{{Key: "$setIntersection", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$guest_allergens", bson.A{}}}},
+					bson.D{{Key: "$ifNull", Value: bson.A{"$food.allergens", bson.A{}}}},
+				}}}},
+			}}}},
+			{Key: "allergy", Value: bson.D{{Key: "$max", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$allergy", false}}}}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "order_id", Value: "$_id.order_id"},
+			{Key: "course", Value: "$_id.course"},
+			{Key: "sent_at", Value: 1},
+			{Key: "allergy", Value: 1},
+			{Key: "items", Value: 1},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "sent_at", Value: 1}}}}
+
+		result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, lookupFoodStage, unwindFoodStage, groupStage, projectStage, sortStage,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing kitchen tickets"})
+			return
+		}
+
+		var tickets []bson.M
+		if err = result.All(ctx, &tickets); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding kitchen tickets"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tickets)
+	}
+}
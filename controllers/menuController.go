@@ -7,6 +7,9 @@ import (
 	"golang-Hotel_Management/models"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,21 +21,151 @@ import (
 
 var menuCollection *mongo.Collection = database.OpenCollection(database.Client, "menu")
 
+// GetMenus lists menus with their foods, taking the same search, filter and
+// sort parameters as GetFoods (see CatalogueQuery). When foods are filtered,
+// each menu lists only its matching foods and menus without any are left out;
+// a search also matches menus by name. "page" and "recordPerPage" page
+// through the menus when given.
 func GetMenus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := menuCollection.Find(context.TODO(), bson.M{})
 		defer cancel()
+
+		query, err := parseCatalogueQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		languages, err := requestLanguages(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// The text index lives on foods, so the search runs there first
+		var textFoodIds []string
+		if query.Text != "" {
+			textFoodIds, err = searchFoodIds(ctx, query.Text)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		conditions, err := foodConditions(ctx, CatalogueQuery{
+			Min_price:         query.Min_price,
+			Max_price:         query.Max_price,
+			Available:         query.Available,
+			Dietary:           query.Dietary,
+			Exclude_allergens: query.Exclude_allergens,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		join := bson.A{bson.D{{Key: "$eq", Value: bson.A{"$menu_id", "$$menu_id"}}}}
+		if query.Text != "" {
+			join = append(join, bson.D{{Key: "$or", Value: bson.A{
+				"$$name_match",
+				bson.D{{Key: "$in", Value: bson.A{"$food_id", textFoodIds}}},
+			}}})
+		}
+		conditions = append(conditions, bson.E{Key: "$expr", Value: bson.D{{Key: "$and", Value: join}}})
+
+		foodStages := bson.A{
+			bson.D{{Key: "$match", Value: conditions}},
+			bson.D{{Key: "$addFields", Value: bson.D{
+				{Key: "sold_out", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$sold_out", false}}}},
+			}}},
+		}
+		if query.Sort == "popularity" {
+			for _, stage := range popularityStages() {
+				foodStages = append(foodStages, stage)
+			}
+		}
+		foodSort := query
+		foodSort.Text = ""
+		foodStages = append(foodStages, foodSortStage(foodSort), localizeStage(languages))
+
+		menuMatch := bson.D{}
+		if query.Menu_id != "" {
+			menuMatch = append(menuMatch, bson.E{Key: "menu_id", Value: query.Menu_id})
+		}
+		if query.Category != "" {
+			menuMatch = append(menuMatch, bson.E{Key: "category", Value: bson.D{
+				{Key: "$regex", Value: "^" + regexp.QuoteMeta(query.Category) + "$"},
+				{Key: "$options", Value: "i"},
+			}})
+		}
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: menuMatch}},
+			{{Key: "$addFields", Value: bson.D{{Key: "name_match", Value: bson.D{{Key: "$regexMatch", Value: bson.D{
+				{Key: "input", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$name", ""}}}},
+				{Key: "regex", Value: regexp.QuoteMeta(query.Text)},
+				{Key: "options", Value: "i"},
+			}}}}}}},
+			{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "food"},
+				{Key: "let", Value: bson.D{{Key: "menu_id", Value: "$menu_id"}, {Key: "name_match", Value: "$name_match"}}},
+				{Key: "pipeline", Value: foodStages},
+				{Key: "as", Value: "foods"},
+			}}},
+		}
+		if query.filtersFoods() {
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "foods.0", Value: bson.D{{Key: "$exists", Value: true}}}}}})
+		}
+
+		direction := 1
+		if query.Descending {
+			direction = -1
+		}
+		switch query.Sort {
+		case "price":
+			pipeline = append(pipeline,
+				bson.D{{Key: "$addFields", Value: bson.D{{Key: "lowest_price", Value: bson.D{{Key: "$min", Value: "$foods.price.amount"}}}}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "lowest_price", Value: direction}, {Key: "menu_id", Value: 1}}}},
+			)
+		case "popularity":
+			pipeline = append(pipeline,
+				bson.D{{Key: "$addFields", Value: bson.D{{Key: "popularity", Value: bson.D{{Key: "$sum", Value: "$foods.popularity"}}}}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "popularity", Value: direction}, {Key: "menu_id", Value: 1}}}},
+			)
+		default:
+			pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "name", Value: direction}, {Key: "menu_id", Value: 1}}}})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.D{{Key: "name_match", Value: 0}}}})
+
+		// Names are translated after sorting, so pages stay in the same order
+		// whatever language they are read in
+		pipeline = append(pipeline, localizeStage(languages))
+
+		if c.Query("page") != "" || c.Query("recordPerPage") != "" {
+			recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+			if err != nil || recordPerPage < 1 {
+				recordPerPage = 10
+			}
+			page, err := strconv.Atoi(c.Query("page"))
+			if err != nil || page < 1 {
+				page = 1
+			}
+			pipeline = append(pipeline,
+				bson.D{{Key: "$skip", Value: (page - 1) * recordPerPage}},
+				bson.D{{Key: "$limit", Value: recordPerPage}},
+			)
+		}
+
+		result, err := menuCollection.Aggregate(ctx, pipeline)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing the menu items"})
 			return
 		}
 
-		var allMenus []bson.M
+		allMenus := []bson.M{}
 		if err = result.All(ctx, &allMenus); err != nil {
 			log.Fatal(err)
 		}
 
+		c.Header("Vary", "Accept-Language")
 		c.JSON(http.StatusOK, allMenus)
 	}
 }
@@ -50,6 +183,15 @@ func GetMenu() gin.HandlerFunc {
 			return
 		}
 
+		languages, err := requestLanguages(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		localizeMenu(&menu, languages)
+		c.Header("Content-Language", menu.Language)
+		c.Header("Vary", "Accept-Language")
+
 		c.JSON(http.StatusOK, menu)
 	}
 }
@@ -64,11 +206,22 @@ func CreateMenu() gin.HandlerFunc {
 			return
 		}
 
+		translations, err := normalizeTranslations(menu.Translations)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		menu.Translations = translations
+
 		validationErr := validate.Struct(menu)
 		if validationErr != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 			return
 		}
+		if menu.Start_Date != nil && menu.End_Date != nil && !menu.End_Date.After(*menu.Start_Date) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end date must be after start date"})
+			return
+		}
 		menu.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		menu.ID = primitive.NewObjectID()
@@ -86,10 +239,164 @@ func CreateMenu() gin.HandlerFunc {
 	}
 }
 
-// inTimeSpan checks whether the 'check' time is within the time span between 'start' and 'end'.
-// checks if 'start' is in the future AND 'end' is after 'start'.
+// inTimeSpan checks whether the 'check' time is within the time span between
+// 'start' (inclusive) and 'end' (exclusive).
 func inTimeSpan(start, end, check time.Time) bool {
-	return start.After(time.Now()) && end.After(start)
+	return !check.Before(start) && check.Before(end)
+}
+
+// weekdays maps time.Weekday to the day names used in menu schedules.
+var weekdays = [...]string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// menuLocation returns the time zone a menu's schedule is written in.
+func menuLocation(menu models.Menu) *time.Location {
+	zone := menu.Timezone
+	if zone == "" {
+		zone = os.Getenv("TIMEZONE")
+	}
+	if location, err := time.LoadLocation(zone); err == nil && zone != "" {
+		return location
+	}
+	return time.Local
+}
+
+// menuActiveAt reports whether a menu can be sold at the given moment: inside
+// its date range, if it has one, and inside one of its weekly windows, if it
+// has any.
+func menuActiveAt(menu models.Menu, at time.Time) bool {
+	if menu.Start_Date != nil && at.Before(*menu.Start_Date) {
+		return false
+	}
+	if menu.End_Date != nil && !at.Before(*menu.End_Date) {
+		return false
+	}
+	if len(menu.Schedule) == 0 {
+		return true
+	}
+
+	local := at.In(menuLocation(menu))
+	for _, window := range menu.Schedule {
+		// Check the window as opened today and, for windows running past
+		// midnight, as opened yesterday.
+		for _, daysAgo := range []int{0, 1} {
+			opened := local.AddDate(0, 0, -daysAgo)
+			if !containsString(window.Days, weekdays[opened.Weekday()]) {
+				continue
+			}
+			start, end, err := windowOn(window, opened)
+			if err == nil && inTimeSpan(start, end, local) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// windowOn returns when a window opens and closes if it opens on day's date.
+func windowOn(window models.MenuWindow, day time.Time) (time.Time, time.Time, error) {
+	startClock, err := time.Parse("15:04", window.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endClock, err := time.Parse("15:04", window.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	year, month, date := day.Date()
+	start := time.Date(year, month, date, startClock.Hour(), startClock.Minute(), 0, 0, day.Location())
+	end := time.Date(year, month, date, endClock.Hour(), endClock.Minute(), 0, 0, day.Location())
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// checkFoodOnSale fails when the food's menu is not active at the given time,
+// or the food has been taken off its menu. Foods that do not belong to a menu
+// can always be sold.
+func checkFoodOnSale(ctx context.Context, food models.Food, at time.Time) error {
+	if food.Archived {
+		return fmt.Errorf("food item %s is no longer on the menu", food.Food_id)
+	}
+	if food.Menu_id == nil || *food.Menu_id == "" {
+		return nil
+	}
+
+	var menu models.Menu
+	if err := menuCollection.FindOne(ctx, bson.M{"menu_id": *food.Menu_id}).Decode(&menu); err != nil {
+		return fmt.Errorf("menu of food item %s was not found", food.Food_id)
+	}
+	if !menuActiveAt(menu, at) {
+		return fmt.Errorf("food item %s is on the %s menu, which is not available now", food.Food_id, menu.Name)
+	}
+	return nil
+}
+
+// GetActiveMenus returns the menus that can be sold at the time given by the
+// "at" query parameter (RFC3339, now by default), each with its foods.
+func GetActiveMenus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		at := time.Now()
+		if value := c.Query("at"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			at = parsed
+		}
+		languages, err := requestLanguages(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := menuCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing the menus"})
+			return
+		}
+		var allMenus []models.Menu
+		if err = result.All(ctx, &allMenus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the menus"})
+			return
+		}
+
+		type activeMenu struct {
+			models.Menu
+			Foods []models.Food `json:"foods"`
+		}
+		activeMenus := []activeMenu{}
+		for _, menu := range allMenus {
+			if !menuActiveAt(menu, at) {
+				continue
+			}
+
+			foodResult, err := foodCollection.Find(ctx, bson.M{"menu_id": menu.Menu_id, "archived": bson.M{"$ne": true}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing the food items"})
+				return
+			}
+			foods := []models.Food{}
+			if err = foodResult.All(ctx, &foods); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the food items"})
+				return
+			}
+
+			localizeMenu(&menu, languages)
+			for i := range foods {
+				localizeFood(&foods[i], languages)
+			}
+			activeMenus = append(activeMenus, activeMenu{Menu: menu, Foods: foods})
+		}
+
+		c.Header("Vary", "Accept-Language")
+		c.JSON(http.StatusOK, activeMenus)
+	}
 }
 
 func UpdateMenu() gin.HandlerFunc {
@@ -105,12 +412,18 @@ func UpdateMenu() gin.HandlerFunc {
 		menuId := c.Param("menu_id")
 		filter := bson.M{"menu_id": menuId}
 
+		if status, err := checkMenuEditable(ctx, menuId); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			defer cancel()
+			return
+		}
+
 		var updateObj primitive.D
 
 		if menu.Start_Date != nil && menu.End_Date != nil {
-			if !inTimeSpan(*menu.Start_Date, *menu.End_Date, time.Now()) {
-				msg := "kindly retype the time"
-				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			if !menu.End_Date.After(*menu.Start_Date) {
+				msg := "end date must be after start date"
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 				defer cancel()
 				return
 			}
@@ -118,6 +431,24 @@ func UpdateMenu() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{Key: "end_date", Value: menu.End_Date})
 		}
 
+		if menu.Schedule != nil {
+			if err := validate.Var(menu.Schedule, "dive"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				defer cancel()
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "schedule", Value: menu.Schedule})
+		}
+
+		if menu.Timezone != "" {
+			if err := validate.Var(menu.Timezone, "timezone"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				defer cancel()
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "timezone", Value: menu.Timezone})
+		}
+
 		if menu.Name != "" {
 			updateObj = append(updateObj, bson.E{Key: "name", Value: menu.Name})
 		}
@@ -126,6 +457,29 @@ func UpdateMenu() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{Key: "category", Value: menu.Category}) // Fixed duplicate "name"
 		}
 
+		if menu.Description != "" {
+			if err := validate.Var(menu.Description, "max=1000"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				defer cancel()
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "description", Value: menu.Description})
+		}
+
+		if menu.Translations != nil {
+			// The translations sent replace all of the menu's translations
+			translations, err := normalizeTranslations(menu.Translations)
+			if err == nil {
+				err = validate.Var(translations, "dive")
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				defer cancel()
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "translations", Value: translations})
+		}
+
 		menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: menu.Updated_at})
 
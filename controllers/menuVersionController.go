@@ -0,0 +1,1028 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var menuVersionCollection *mongo.Collection = database.OpenCollection(database.Client, "menuVersion")
+
+// DraftRequest names who starts a menu draft.
+type DraftRequest struct {
+	Created_by *string `json:"created_by" validate:"required"`
+}
+
+// PublishRequest carries the manager approval that publishing a draft and
+// rolling back to an earlier version need.
+type PublishRequest struct {
+	Manager_id  *string `json:"manager_id" validate:"required"`
+	Manager_pin *string `json:"manager_pin" validate:"required"`
+}
+
+// FieldChange is one field that differs between the published menu and a draft.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// FoodDiff lists what a draft changes about one food.
+type FoodDiff struct {
+	Food_id string        `json:"food_id"`
+	Name    string        `json:"name"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// MenuDiff is what publishing a draft would change about the menu guests see.
+// Warnings point out changes worth a second look, such as a food priced at
+// nothing.
+type MenuDiff struct {
+	Menu_id           string        `json:"menu_id"`
+	Published_version int           `json:"published_version"`
+	Menu_changes      []FieldChange `json:"menu_changes"`
+	Added_foods       []models.Food `json:"added_foods"`
+	Removed_foods     []models.Food `json:"removed_foods"`
+	Changed_foods     []FoodDiff    `json:"changed_foods"`
+	Warnings          []string      `json:"warnings"`
+}
+
+var errDraftChanged = errors.New("the draft was changed by someone else; fetch it again and redo the edit")
+
+// The fields a menu version carries, by their JSON names. Sold-out state,
+// remaining portions and images belong to the food on the floor and are never
+// changed by publishing.
+var (
+	menuVersionFields = []string{"name", "category", "description", "translations", "start_date", "end_date", "schedule", "timezone"}
+	foodVersionFields = []string{"name", "description", "translations", "price", "size_prices", "tax_category", "allergens", "dietary_tags", "nutrition", "bundle"}
+)
+
+// liveMenu reads a menu and its foods as guests see them.
+func liveMenu(ctx context.Context, menuId string) (models.Menu, []models.Food, error) {
+	var menu models.Menu
+	if err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu); err != nil {
+		return menu, nil, err
+	}
+	result, err := foodCollection.Find(ctx, bson.M{"menu_id": menuId, "archived": bson.M{"$ne": true}}, options.Find().SetSort(bson.D{{Key: "food_id", Value: 1}}))
+	if err != nil {
+		return menu, nil, errors.New("error occurred while listing the food items")
+	}
+	foods := []models.Food{}
+	if err = result.All(ctx, &foods); err != nil {
+		return menu, nil, errors.New("error occurred while decoding the food items")
+	}
+	return menu, foods, nil
+}
+
+// findDraft returns the open draft of a menu.
+func findDraft(ctx context.Context, menuId string) (models.MenuVersion, error) {
+	var draft models.MenuVersion
+	err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": menuId, "status": "DRAFT"}).Decode(&draft)
+	return draft, err
+}
+
+// menuHasDraft reports whether a menu has a draft open.
+func menuHasDraft(ctx context.Context, menuId string) (bool, error) {
+	count, err := menuVersionCollection.CountDocuments(ctx, bson.M{"menu_id": menuId, "status": "DRAFT"})
+	if err != nil {
+		return false, errors.New("error occurred while checking for a menu draft")
+	}
+	return count > 0, nil
+}
+
+// checkMenuEditable refuses edits to the live copy of a menu that has a
+// draft open, since publishing the draft would silently undo them. The
+// status to answer with comes back along with the error.
+func checkMenuEditable(ctx context.Context, menuId string) (int, error) {
+	hasDraft, err := menuHasDraft(ctx, menuId)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if hasDraft {
+		return http.StatusConflict, errors.New("the menu has a draft open; make the change in the draft")
+	}
+	return http.StatusOK, nil
+}
+
+// saveDraft stores an edited draft, unless someone else saved it since it
+// was read.
+func saveDraft(ctx context.Context, draft *models.MenuVersion) error {
+	revision := draft.Revision
+	draft.Revision++
+	draft.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	result, err := menuVersionCollection.ReplaceOne(
+		ctx,
+		bson.M{"menu_version_id": draft.Menu_version_id, "status": "DRAFT", "revision": revision},
+		draft,
+	)
+	if err != nil {
+		return errors.New("menu draft update failed")
+	}
+	if result.MatchedCount == 0 {
+		return errDraftChanged
+	}
+	return nil
+}
+
+// GetMenuVersions lists the draft and every published version of a menu,
+// newest first.
+func GetMenuVersions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "version", Value: -1}})
+		result, err := menuVersionCollection.Find(ctx, bson.M{"menu_id": c.Param("menu_id")}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing the menu versions"})
+			return
+		}
+		versions := []models.MenuVersion{}
+		if err = result.All(ctx, &versions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the menu versions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, versions)
+	}
+}
+
+// CreateMenuDraft starts a draft from the menu and foods guests currently
+// see. The first draft of a menu also records that state as version 1, so
+// there is always a version to roll back to.
+func CreateMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request DraftRequest
+		var published models.MenuVersion
+
+		menuId := c.Param("menu_id")
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		validationErr := validate.Struct(request)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		hasDraft, err := menuHasDraft(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if hasDraft {
+			c.JSON(http.StatusConflict, gin.H{"error": "the menu already has a draft"})
+			return
+		}
+
+		menu, foods, err := liveMenu(ctx, menuId)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = menuVersionCollection.FindOne(ctx, bson.M{"menu_id": menuId, "status": "PUBLISHED"}).Decode(&published)
+		if err == mongo.ErrNoDocuments {
+			published = models.MenuVersion{
+				Menu_id:      menuId,
+				Version:      1,
+				Status:       "PUBLISHED",
+				Menu:         menu,
+				Foods:        foods,
+				Published_at: &now,
+				Created_at:   now,
+				Updated_at:   now,
+			}
+			published.ID = primitive.NewObjectID()
+			published.Menu_version_id = published.ID.Hex()
+			if _, err := menuVersionCollection.InsertOne(ctx, published); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "menu version was not recorded"})
+				return
+			}
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the published menu"})
+			return
+		}
+
+		draft := models.MenuVersion{
+			Menu_id:     menuId,
+			Status:      "DRAFT",
+			Based_on:    published.Version,
+			Menu:        menu,
+			Foods:       foods,
+			Base_prices: map[string]models.FoodPrices{},
+			Created_by:  request.Created_by,
+			Created_at:  now,
+			Updated_at:  now,
+		}
+		for _, food := range foods {
+			draft.Base_prices[food.Food_id] = models.FoodPrices{Price: food.Price, Size_prices: food.Size_prices}
+		}
+		draft.ID = primitive.NewObjectID()
+		draft.Menu_version_id = draft.ID.Hex()
+
+		if _, err := menuVersionCollection.InsertOne(ctx, draft); err != nil {
+			msg := fmt.Sprintf("Menu draft was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// GetMenuDraft returns the open draft of a menu.
+func GetMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		draft, err := findDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// DiscardMenuDraft throws a draft away, leaving the published menu as it is.
+func DiscardMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := menuVersionCollection.DeleteOne(ctx, bson.M{"menu_id": c.Param("menu_id"), "status": "DRAFT"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu draft was not discarded"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// UpdateMenuDraft changes the menu details of a draft, the way UpdateMenu
+// changes those of the live menu.
+func UpdateMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var menu models.Menu
+
+		if err := c.BindJSON(&menu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		draft, err := findDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		if menu.Start_Date != nil && menu.End_Date != nil {
+			draft.Menu.Start_Date, draft.Menu.End_Date = menu.Start_Date, menu.End_Date
+		}
+		if menu.Schedule != nil {
+			draft.Menu.Schedule = menu.Schedule
+		}
+		if menu.Timezone != "" {
+			draft.Menu.Timezone = menu.Timezone
+		}
+		if menu.Name != "" {
+			draft.Menu.Name = menu.Name
+		}
+		if menu.Category != "" {
+			draft.Menu.Category = menu.Category
+		}
+		if menu.Description != "" {
+			draft.Menu.Description = menu.Description
+		}
+		if menu.Translations != nil {
+			translations, err := normalizeTranslations(menu.Translations)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			draft.Menu.Translations = translations
+		}
+
+		if err := validate.Struct(draft.Menu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if draft.Menu.Start_Date != nil && draft.Menu.End_Date != nil && !draft.Menu.End_Date.After(*draft.Menu.Start_Date) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end date must be after start date"})
+			return
+		}
+
+		if err := saveDraft(ctx, &draft); err == errDraftChanged {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// checkDraftFood readies a food sent for a draft: it is checked the way
+// CreateFood checks a new food, and always belongs to the draft's menu.
+func checkDraftFood(ctx context.Context, menuId string, food *models.Food) error {
+	food.Menu_id = &menuId
+
+	translations, err := normalizeTranslations(food.Translations)
+	if err != nil {
+		return err
+	}
+	food.Translations = translations
+
+	if err := normalizeFoodPrices(food); err != nil {
+		return err
+	}
+	if err := validate.Struct(food); err != nil {
+		return err
+	}
+	if err := checkDietaryTags(food.Allergens, food.Dietary_tags); err != nil {
+		return err
+	}
+	if food.Bundle != nil {
+		if err := checkBundle(ctx, *food); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddDraftFood adds a new food to a draft. It reaches guests when the draft
+// is published.
+func AddDraftFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var food models.Food
+
+		menuId := c.Param("menu_id")
+
+		if err := c.BindJSON(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		draft, err := findDraft(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		if err := checkDraftFood(ctx, menuId, &food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Images and availability are set on the food once it is published
+		food.Food_image, food.Images = nil, nil
+		food.Sold_out, food.Sold_out_at, food.Remaining_portions = false, nil, nil
+		food.Price_effective_from = nil
+		food.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		food.Updated_at = food.Created_at
+		food.ID = primitive.NewObjectID()
+		food.Food_id = food.ID.Hex()
+
+		draft.Foods = append(draft.Foods, food)
+		if err := saveDraft(ctx, &draft); err == errDraftChanged {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, food)
+	}
+}
+
+// SetDraftFood replaces a food of a draft with the one sent, prices
+// included. What is not sent is cleared, as with CreateFood.
+func SetDraftFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var food models.Food
+
+		menuId := c.Param("menu_id")
+		foodId := c.Param("food_id")
+
+		if err := c.BindJSON(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		draft, err := findDraft(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		index := -1
+		for i, existing := range draft.Foods {
+			if existing.Food_id == foodId {
+				index = i
+			}
+		}
+		if index < 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food is not in the draft; new foods are added with POST /menus/:menu_id/draft/foods"})
+			return
+		}
+
+		food.Food_id = foodId
+		if err := checkDraftFood(ctx, menuId, &food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Only the menu content is drafted; the rest stays as it was
+		existing := draft.Foods[index]
+		food.ID, food.Created_at = existing.ID, existing.Created_at
+		food.Food_image, food.Images = existing.Food_image, existing.Images
+		food.Sold_out, food.Sold_out_at, food.Remaining_portions = existing.Sold_out, existing.Sold_out_at, existing.Remaining_portions
+		food.Price_effective_from = existing.Price_effective_from
+		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		draft.Foods[index] = food
+
+		if err := saveDraft(ctx, &draft); err == errDraftChanged {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, food)
+	}
+}
+
+// RemoveDraftFood takes a food out of a draft. Publishing the draft archives
+// it, taking it off the menu.
+func RemoveDraftFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+
+		draft, err := findDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		foods := []models.Food{}
+		for _, food := range draft.Foods {
+			if food.Food_id != foodId {
+				foods = append(foods, food)
+			}
+		}
+		if len(foods) == len(draft.Foods) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food is not in the draft"})
+			return
+		}
+		draft.Foods = foods
+
+		if err := saveDraft(ctx, &draft); err == errDraftChanged {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// GetMenuDraftDiff previews what publishing the draft would change.
+func GetMenuDraftDiff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+
+		draft, err := findDraft(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+		menu, foods, err := liveMenu(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the published menu"})
+			return
+		}
+
+		diff := diffMenu(draft, menu, foods)
+		var published models.MenuVersion
+		if err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": menuId, "status": "PUBLISHED"}).Decode(&published); err == nil {
+			diff.Published_version = published.Version
+		}
+
+		c.JSON(http.StatusOK, diff)
+	}
+}
+
+// diffMenu compares a version with the menu and foods guests see.
+func diffMenu(version models.MenuVersion, menu models.Menu, foods []models.Food) MenuDiff {
+	diff := MenuDiff{
+		Menu_id:       menu.Menu_id,
+		Menu_changes:  fieldChanges(menu, version.Menu, menuVersionFields),
+		Added_foods:   []models.Food{},
+		Removed_foods: []models.Food{},
+		Changed_foods: []FoodDiff{},
+		Warnings:      []string{},
+	}
+
+	live := map[string]models.Food{}
+	for _, food := range foods {
+		live[food.Food_id] = food
+	}
+	drafted := map[string]bool{}
+	for _, food := range withLivePrices(version, live) {
+		drafted[food.Food_id] = true
+		before, exists := live[food.Food_id]
+		if !exists {
+			diff.Added_foods = append(diff.Added_foods, food)
+			diff.Warnings = append(diff.Warnings, priceWarnings(nil, food)...)
+			continue
+		}
+		if changes := fieldChanges(before, food, foodVersionFields); len(changes) > 0 {
+			diff.Changed_foods = append(diff.Changed_foods, FoodDiff{Food_id: food.Food_id, Name: foodName(food), Changes: changes})
+			diff.Warnings = append(diff.Warnings, priceWarnings(&before, food)...)
+		}
+	}
+	for _, food := range foods {
+		if !drafted[food.Food_id] {
+			diff.Removed_foods = append(diff.Removed_foods, food)
+		}
+	}
+	return diff
+}
+
+// withLivePrices returns the foods of a version, giving those whose prices
+// the draft left as it found them the prices they have now: a scheduled
+// change applied while the draft was open is kept, not undone.
+func withLivePrices(version models.MenuVersion, live map[string]models.Food) []models.Food {
+	foods := make([]models.Food, len(version.Foods))
+	copy(foods, version.Foods)
+	for i, food := range foods {
+		base, drafted := version.Base_prices[food.Food_id]
+		current, exists := live[food.Food_id]
+		if !drafted || !exists {
+			continue
+		}
+		if reflect.DeepEqual(base.Price, food.Price) && reflect.DeepEqual(base.Size_prices, food.Size_prices) {
+			foods[i].Price, foods[i].Size_prices = current.Price, current.Size_prices
+		}
+	}
+	return foods
+}
+
+// fieldChanges compares the named JSON fields of two values.
+func fieldChanges(from, to interface{}, fields []string) []FieldChange {
+	before, after := jsonFields(from), jsonFields(to)
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, FieldChange{Field: field, From: before[field], To: after[field]})
+		}
+	}
+	return changes
+}
+
+// jsonFields returns a value as the fields it is sent to clients with.
+func jsonFields(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(value)
+	if err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+func foodName(food models.Food) string {
+	if food.Name == nil {
+		return food.Food_id
+	}
+	return *food.Name
+}
+
+// priceWarnings points out a food that would be sold for nothing, or whose
+// price would fall by more than half.
+func priceWarnings(before *models.Food, after models.Food) []string {
+	prices := map[string]models.Money{}
+	if after.Price != nil {
+		prices["M"] = *after.Price
+	}
+	for size, price := range after.Size_prices {
+		prices[size] = price
+	}
+
+	warnings := []string{}
+	for _, size := range []string{"S", "M", "L"} {
+		price, ok := prices[size]
+		if !ok {
+			continue
+		}
+		if price.Amount <= 0 {
+			warnings = append(warnings, fmt.Sprintf("%s (%s) would be priced at %s", foodName(after), size, price))
+			continue
+		}
+		if before == nil {
+			continue
+		}
+		previous, err := priceForSize(*before, size)
+		if err == nil && price.Amount*2 < previous.Amount {
+			warnings = append(warnings, fmt.Sprintf("%s (%s) would drop from %s to %s", foodName(after), size, previous, price))
+		}
+	}
+	return warnings
+}
+
+// PublishMenuDraft puts a draft in front of guests in one transaction: the
+// menu, its foods and their prices all change together or not at all.
+func PublishMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PublishRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		validationErr := validate.Struct(request)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if err := verifyManagerApproval(ctx, request.Manager_id, request.Manager_pin); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		draft, err := findDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the menu has no draft"})
+			return
+		}
+
+		published, err := publishMenuVersion(ctx, draft, request.Manager_id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, published)
+	}
+}
+
+// RollbackMenu publishes an earlier version of a menu again, as a new
+// version. An open draft is left alone.
+func RollbackMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PublishRequest
+		var version models.MenuVersion
+
+		menuId := c.Param("menu_id")
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		validationErr := validate.Struct(request)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		number, err := strconv.Atoi(c.Param("version"))
+		if err != nil || number < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a version number"})
+			return
+		}
+		if err := verifyManagerApproval(ctx, request.Manager_id, request.Manager_pin); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = menuVersionCollection.FindOne(ctx, bson.M{
+			"menu_id": menuId,
+			"version": number,
+			"status":  bson.M{"$in": bson.A{"PUBLISHED", "SUPERSEDED"}},
+		}).Decode(&version)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu version was not found"})
+			return
+		}
+		if version.Status == "PUBLISHED" {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("version %d is already published", number)})
+			return
+		}
+
+		var current models.MenuVersion
+		if err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": menuId, "status": "PUBLISHED"}).Decode(&current); err == nil {
+			version.Based_on = current.Version
+		}
+		version.ID = primitive.NewObjectID()
+		version.Menu_version_id = version.ID.Hex()
+		version.Status = "DRAFT"
+		version.Revision = 0
+		version.Rolled_back_from = &number
+		version.Created_by = request.Manager_id
+		version.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		published, err := publishMenuVersion(ctx, version, request.Manager_id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, published)
+	}
+}
+
+// publishMenuVersion makes a version the one guests see: the menu takes its
+// details, its foods are updated or added, and every price that changes is
+// written to the price history. Foods it leaves out are archived rather than
+// deleted, since orders, tickets and invoices still name them, and their
+// scheduled price changes are cancelled. It all runs in one transaction, so
+// MongoDB has to run as a replica set.
+func publishMenuVersion(ctx context.Context, version models.MenuVersion, publishedBy *string) (models.MenuVersion, error) {
+	menu, foods, err := liveMenu(ctx, version.Menu_id)
+	if err != nil {
+		return version, errors.New("menu was not found")
+	}
+
+	live := map[string]models.Food{}
+	for _, food := range foods {
+		live[food.Food_id] = food
+	}
+	var keptIds, removedIds []string
+	for _, food := range version.Foods {
+		keptIds = append(keptIds, food.Food_id)
+	}
+	for _, food := range foods {
+		if !containsString(keptIds, food.Food_id) {
+			removedIds = append(removedIds, food.Food_id)
+		}
+	}
+	if err := checkRemovedFoods(ctx, version, removedIds); err != nil {
+		return version, err
+	}
+
+	var latest models.MenuVersion
+	number := 1
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	if err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": version.Menu_id, "status": bson.M{"$ne": "DRAFT"}}, opts).Decode(&latest); err == nil {
+		number = latest.Version + 1
+	}
+
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return version, errors.New("menu was not published")
+	}
+	defer session.EndSession(ctx)
+
+	var published models.MenuVersion
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		reason := fmt.Sprintf("published with menu version %d", number)
+
+		_, err := menuCollection.UpdateOne(sc, bson.M{"menu_id": menu.Menu_id}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "name", Value: version.Menu.Name},
+			{Key: "category", Value: version.Menu.Category},
+			{Key: "description", Value: version.Menu.Description},
+			{Key: "translations", Value: version.Menu.Translations},
+			{Key: "start_date", Value: version.Menu.Start_Date},
+			{Key: "end_date", Value: version.Menu.End_Date},
+			{Key: "schedule", Value: version.Menu.Schedule},
+			{Key: "timezone", Value: version.Menu.Timezone},
+			{Key: "updated_at", Value: now},
+		}}})
+		if err != nil {
+			return nil, err
+		}
+
+		publishedFoods := []models.Food{}
+		for _, food := range withLivePrices(version, live) {
+			before, exists := live[food.Food_id]
+			if !exists {
+				// New, or back from an earlier version: on sale with a fresh
+				// history, replacing the archived food if there is one
+				food.Sold_out, food.Sold_out_at, food.Remaining_portions = false, nil, nil
+				food.Archived, food.Archived_at = false, nil
+				food.Price_effective_from = &now
+				food.Updated_at = now
+				if food.Created_at.IsZero() {
+					food.Created_at = now
+				}
+				_, err := foodCollection.ReplaceOne(sc, bson.M{"food_id": food.Food_id}, food, options.Replace().SetUpsert(true))
+				if err != nil {
+					return nil, err
+				}
+				if err := recordPublishedPrice(sc, food, nil, publishedBy, reason, now); err != nil {
+					return nil, err
+				}
+				publishedFoods = append(publishedFoods, food)
+				continue
+			}
+
+			updateObj := bson.D{
+				{Key: "name", Value: food.Name},
+				{Key: "description", Value: food.Description},
+				{Key: "translations", Value: food.Translations},
+				{Key: "tax_category", Value: food.Tax_category},
+				{Key: "allergens", Value: food.Allergens},
+				{Key: "dietary_tags", Value: food.Dietary_tags},
+				{Key: "nutrition", Value: food.Nutrition},
+				{Key: "bundle", Value: food.Bundle},
+				{Key: "updated_at", Value: now},
+			}
+			if !reflect.DeepEqual(before.Price, food.Price) || !reflect.DeepEqual(before.Size_prices, food.Size_prices) {
+				updateObj = append(updateObj,
+					bson.E{Key: "price", Value: food.Price},
+					bson.E{Key: "size_prices", Value: food.Size_prices},
+					bson.E{Key: "price_effective_from", Value: now},
+				)
+				if err := recordPublishedPrice(sc, food, &before, publishedBy, reason, now); err != nil {
+					return nil, err
+				}
+				before.Price_effective_from = &now
+			}
+			if _, err := foodCollection.UpdateOne(sc, bson.M{"food_id": food.Food_id}, bson.D{{Key: "$set", Value: updateObj}}); err != nil {
+				return nil, err
+			}
+
+			// The version records the food as it now stands on the menu
+			food.ID, food.Created_at = before.ID, before.Created_at
+			food.Food_image, food.Images = before.Food_image, before.Images
+			food.Sold_out, food.Sold_out_at, food.Remaining_portions = before.Sold_out, before.Sold_out_at, before.Remaining_portions
+			food.Price_effective_from = before.Price_effective_from
+			food.Updated_at = now
+			publishedFoods = append(publishedFoods, food)
+		}
+
+		if len(removedIds) > 0 {
+			_, err := foodCollection.UpdateMany(sc, bson.M{"food_id": bson.M{"$in": removedIds}}, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "archived", Value: true},
+				{Key: "archived_at", Value: now},
+				{Key: "updated_at", Value: now},
+			}}})
+			if err != nil {
+				return nil, err
+			}
+			_, err = priceChangeCollection.UpdateMany(
+				sc,
+				bson.M{"food_id": bson.M{"$in": removedIds}, "status": "SCHEDULED"},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "status", Value: "CANCELLED"},
+					{Key: "cancelled_by", Value: publishedBy},
+					{Key: "cancelled_at", Value: now},
+				}}},
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = menuVersionCollection.UpdateMany(
+			sc,
+			bson.M{"menu_id": version.Menu_id, "status": "PUBLISHED"},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "SUPERSEDED"}, {Key: "updated_at", Value: now}}}},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		published = version
+		published.Version = number
+		published.Status = "PUBLISHED"
+		published.Foods = publishedFoods
+		published.Base_prices = nil
+		published.Published_by = publishedBy
+		published.Published_at = &now
+		published.Updated_at = now
+
+		// A rolled back version is new and inserted here; a draft published
+		// twice at the same moment fails the second time on its _id.
+		_, err = menuVersionCollection.ReplaceOne(
+			sc,
+			bson.M{"menu_version_id": version.Menu_version_id, "status": "DRAFT"},
+			published,
+			options.Replace().SetUpsert(true),
+		)
+		return nil, err
+	})
+	if err != nil {
+		log.Println("menu", version.Menu_id, "was not published:", err)
+		return version, errors.New("menu was not published; nothing was changed")
+	}
+	return published, nil
+}
+
+// recordPublishedPrice adds the price a food is published at to its price
+// history, as applied straight away.
+func recordPublishedPrice(ctx context.Context, food models.Food, before *models.Food, publishedBy *string, reason string, at time.Time) error {
+	change := models.PriceChange{
+		Food_id:        food.Food_id,
+		Price:          food.Price,
+		Size_prices:    food.Size_prices,
+		Effective_from: at,
+		Status:         "APPLIED",
+		Changed_by:     publishedBy,
+		Reason:         &reason,
+		Applied_at:     &at,
+		Created_at:     at,
+	}
+	if before != nil {
+		change.Previous_price = before.Price
+		change.Previous_size_prices = before.Size_prices
+	}
+	change.ID = primitive.NewObjectID()
+	change.Price_change_id = change.ID.Hex()
+
+	_, err := priceChangeCollection.InsertOne(ctx, change)
+	return err
+}
+
+// checkRemovedFoods refuses to remove foods that a bundle, on this menu or
+// another, would still be made of.
+func checkRemovedFoods(ctx context.Context, version models.MenuVersion, removedIds []string) error {
+	if len(removedIds) == 0 {
+		return nil
+	}
+	for _, food := range version.Foods {
+		if food.Bundle == nil {
+			continue
+		}
+		for _, slot := range food.Bundle.Slots {
+			for _, foodId := range slot.Food_ids {
+				if containsString(removedIds, foodId) {
+					return fmt.Errorf("food item %s is part of the bundle %s and cannot be removed", foodId, foodName(food))
+				}
+			}
+		}
+	}
+
+	var bundle models.Food
+	err := foodCollection.FindOne(ctx, bson.M{
+		"menu_id":               bson.M{"$ne": version.Menu_id},
+		"bundle.slots.food_ids": bson.M{"$in": removedIds},
+		"archived":              bson.M{"$ne": true},
+	}).Decode(&bundle)
+	if err == nil {
+		return fmt.Errorf("the bundle %s is made of foods the draft removes", foodName(bundle))
+	}
+	if err != mongo.ErrNoDocuments {
+		return errors.New("error occurred while checking the bundles")
+	}
+	return nil
+}
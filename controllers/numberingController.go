@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of legal documents that are numbered, each with its own sequence.
+const (
+	InvoiceSequence    = "invoice"
+	CreditNoteSequence = "creditNote"
+)
+
+var sequenceCollection *mongo.Collection = database.OpenCollection(database.Client, "sequence")
+
+// Default number formats. {YEAR} is the fiscal year and {SEQ:n} the sequence
+// number padded with zeros to n digits.
+var defaultNumberFormats = map[string]string{
+	InvoiceSequence:    envString("INVOICE_NUMBER_FORMAT", "INV-{YEAR}-{SEQ:6}"),
+	CreditNoteSequence: envString("CREDIT_NOTE_NUMBER_FORMAT", "CN-{YEAR}-{SEQ:6}"),
+}
+
+var sequencePlaceholder = regexp.MustCompile(`\{SEQ(?::(\d+))?\}`)
+
+// checkNumberFormat makes sure a number format carries the sequence number and
+// the fiscal year, without which two documents would get the same number.
+func checkNumberFormat(format string) error {
+	if !sequencePlaceholder.MatchString(format) {
+		return fmt.Errorf("number format %q must contain {SEQ} or {SEQ:n}", format)
+	}
+	if !strings.Contains(format, "{YEAR}") {
+		return fmt.Errorf("number format %q must contain {YEAR}, as sequences restart every fiscal year", format)
+	}
+	return nil
+}
+
+// EnsureDocumentNumbering checks the default number formats and makes invoice
+// and credit note numbers unique per restaurant, so a number can never be
+// issued twice. It is called once at startup.
+func EnsureDocumentNumbering(ctx context.Context) error {
+	for _, format := range defaultNumberFormats {
+		if err := checkNumberFormat(format); err != nil {
+			return err
+		}
+	}
+
+	// Documents from before numbering carry no number
+	numbered := func(field string) *options.IndexOptions {
+		return options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}})
+	}
+	_, err := invoiceCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "invoice_number", Value: 1}},
+		Options: numbered("invoice_number"),
+	})
+	if err != nil {
+		return fmt.Errorf("invoice number index: %w", err)
+	}
+	_, err = creditNoteCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "number", Value: 1}},
+		Options: numbered("number"),
+	})
+	if err != nil {
+		return fmt.Errorf("credit note number index: %w", err)
+	}
+	return nil
+}
+
+func envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// DocumentNumber is a legal number allocated to an invoice or credit note.
+type DocumentNumber struct {
+	Number      string
+	Fiscal_year int
+	Sequence    int64
+}
+
+// fiscalYear returns the year a restaurant's fiscal year containing t started in.
+func fiscalYear(restaurant models.Restaurant, t time.Time) int {
+	startMonth := 1
+	if restaurant.Fiscal_year_start_month != nil {
+		startMonth = *restaurant.Fiscal_year_start_month
+	}
+	if int(t.Month()) < startMonth {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// formatDocumentNumber fills the {YEAR} and {SEQ:n} placeholders of a format.
+func formatDocumentNumber(format string, year int, sequence int64) string {
+	number := strings.ReplaceAll(format, "{YEAR}", strconv.Itoa(year))
+	return sequencePlaceholder.ReplaceAllStringFunc(number, func(placeholder string) string {
+		width := 0
+		if digits := sequencePlaceholder.FindStringSubmatch(placeholder)[1]; digits != "" {
+			width, _ = strconv.Atoi(digits)
+		}
+		return fmt.Sprintf("%0*d", width, sequence)
+	})
+}
+
+// allocateNumber takes the next number of a restaurant's sequence for the
+// current fiscal year. The counter is incremented atomically in Mongo, so
+// concurrent requests never receive the same number and a number once taken
+// is never handed out again.
+func allocateNumber(ctx context.Context, kind string, restaurant models.Restaurant) (DocumentNumber, error) {
+	year := fiscalYear(restaurant, time.Now())
+	key := fmt.Sprintf("%s:%s:%d", kind, restaurant.Restaurant_id, year)
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: int64(1)}}}}
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := sequenceCollection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&counter)
+	// Two first allocations can race to create the counter; the loser retries
+	// and increments the one the winner created.
+	if mongo.IsDuplicateKeyError(err) {
+		err = sequenceCollection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&counter)
+	}
+	if err != nil {
+		return DocumentNumber{}, fmt.Errorf("%s number could not be allocated", kind)
+	}
+
+	format := defaultNumberFormats[kind]
+	if kind == InvoiceSequence && restaurant.Invoice_number_format != nil {
+		format = *restaurant.Invoice_number_format
+	}
+	if kind == CreditNoteSequence && restaurant.Credit_note_number_format != nil {
+		format = *restaurant.Credit_note_number_format
+	}
+
+	return DocumentNumber{
+		Number:      formatDocumentNumber(format, year, counter.Seq),
+		Fiscal_year: year,
+		Sequence:    counter.Seq,
+	}, nil
+}
+
+// issueInvoices numbers the invoices and stores them. If storing fails after
+// the numbers were taken, the invoices are recorded as voided instead so that
+// the sequence shows no gap.
+func issueInvoices(ctx context.Context, restaurant models.Restaurant, invoices []models.Invoice) (*mongo.InsertManyResult, error) {
+	for i := range invoices {
+		number, err := allocateNumber(ctx, InvoiceSequence, restaurant)
+		if err != nil {
+			voidUnissuedInvoices(ctx, invoices[:i])
+			return nil, err
+		}
+		invoices[i].Invoice_number = number.Number
+		invoices[i].Fiscal_year = number.Fiscal_year
+		invoices[i].Sequence = number.Sequence
+	}
+
+	documents := []interface{}{}
+	for _, invoice := range invoices {
+		documents = append(documents, invoice)
+	}
+
+	result, err := invoiceCollection.InsertMany(ctx, documents)
+	if err != nil {
+		voidUnissuedInvoices(ctx, invoices)
+		return nil, err
+	}
+	return result, nil
+}
+
+// voidUnissuedInvoices keeps numbered invoices that could not be issued as
+// voided records. Any of them that were stored before the failure are voided
+// too, since the caller was told that issuing failed.
+func voidUnissuedInvoices(ctx context.Context, invoices []models.Invoice) {
+	reason := "not issued: storing the invoice failed"
+	voidedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	for _, invoice := range invoices {
+		invoice.Voided = true
+		invoice.Void_reason = &reason
+		invoice.Voided_at = &voidedAt
+		_, err := invoiceCollection.ReplaceOne(ctx, bson.M{"_id": invoice.ID}, invoice, options.Replace().SetUpsert(true))
+		if err != nil {
+			log.Println("voided invoice", invoice.Invoice_number, "could not be recorded:", err)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"golang-Hotel_Management/database"
 	"golang-Hotel_Management/models"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,10 +28,18 @@ var tableCollection *mongo.Collection = database.OpenCollection(database.Client,
 func GetOrders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := orderCollection.Find(context.TODO(), bson.M{})
+
+		// ?order_type=TAKEAWAY,DELIVERY narrows the list to what is going out the door
+		filter := bson.M{}
+		if orderType := c.Query("order_type"); orderType != "" {
+			filter["order_type"] = bson.M{"$in": strings.Split(orderType, ",")}
+		}
+
+		result, err := orderCollection.Find(context.TODO(), filter)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing order items"})
+			return
 		}
 
 		var allOrders []bson.M
@@ -76,6 +88,11 @@ func CreateOrder() gin.HandlerFunc {
 			return
 		}
 
+		if err := applyOrderTypeRules(&order.Fulfilment, order.Table_id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		if order.Table_id != nil {
 			err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
 			defer cancel()
@@ -91,6 +108,7 @@ func CreateOrder() gin.HandlerFunc {
 
 		order.ID = primitive.NewObjectID()
 		order.Order_id = order.ID.Hex()
+		order.Status = "OPEN"
 
 		result, insertErr := orderCollection.InsertOne(ctx, order)
 		if insertErr != nil {
@@ -173,14 +191,198 @@ func OrderItemOrderCreator(order models.Order) string {
 	// This is a human-readable form of the document ID.
 	order.Order_id = order.ID.Hex()
 
-	// Insert the newly created order into the MongoDB orders collection.
-	// 'ctx' should be a context with timeout (assumed to be defined outside this function).
-	orderCollection.InsertOne(ctx, order)
+	// Every new order starts out open; voiding it moves it to VOIDED.
+	order.Status = "OPEN"
 
-	// Cancel the context after the operation is complete to free up resources.
-	// 'cancel' should also be defined in the parent function or scope.
+	// Insert the newly created order into the MongoDB orders collection,
+	// using a context of its own so repeated calls don't share a cancelled one.
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
+	orderCollection.InsertOne(ctx, order)
 
 	// Return the string representation of the newly created order ID.
 	return order.Order_id
 }
+
+// SendOrder sends every item of the order that is neither held nor already
+// sent to the kitchen. Held courses go out later through FireCourse. Once
+// sent, voiding an item needs a manager's approval.
+func SendOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+		filter := bson.M{
+			"order_id": orderId,
+			"sent_at":  nil,
+			"held":     bson.M{"$ne": true},
+			"voided":   bson.M{"$ne": true},
+		}
+
+		courses, err := orderItemCollection.Distinct(ctx, "course", filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading the order courses"})
+			return
+		}
+
+		sentAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := orderItemCollection.UpdateMany(
+			ctx,
+			filter,
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "sent_at", Value: sentAt},
+				{Key: "updated_at", Value: sentAt},
+			}}},
+		)
+		if err != nil {
+			msg := fmt.Sprintf("order could not be sent to the kitchen")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		for _, course := range courses {
+			if err := recordCourseFired(ctx, orderId, courseNumber(course), sentAt, nil); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "course timing was not recorded"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// orderTypeRule holds what an order of a given type must carry and what it costs.
+type orderTypeRule struct {
+	requiresTable    bool
+	requiresCustomer bool
+	requiresAddress  bool
+	requiresRoom     bool
+	deliveryFee      models.Money
+	minimumOrder     models.Money
+}
+
+// orderTypeRules lists the rules per order type. The delivery fee and the
+// minimum order values can be tuned through the environment.
+var orderTypeRules = map[string]orderTypeRule{
+	"DINE_IN": {
+		requiresTable: true,
+	},
+	"TAKEAWAY": {
+		requiresCustomer: true,
+		minimumOrder:     envMoney("TAKEAWAY_MINIMUM_ORDER", "0"),
+	},
+	"DELIVERY": {
+		requiresCustomer: true,
+		requiresAddress:  true,
+		deliveryFee:      envMoney("DELIVERY_FEE", "3.50"),
+		minimumOrder:     envMoney("DELIVERY_MINIMUM_ORDER", "15.00"),
+	},
+	"ROOM_SERVICE": {
+		requiresRoom: true,
+		deliveryFee:  envMoney("ROOM_SERVICE_FEE", "0"),
+	},
+}
+
+// envFloat reads a float from the environment, falling back to def when unset or invalid.
+func envFloat(name string, def float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return value
+	}
+	return def
+}
+
+// envMoney reads a decimal amount such as "3.50" from the environment in the
+// default currency, falling back to def when unset or invalid.
+func envMoney(name string, def string) models.Money {
+	if value, err := models.ParseMoney(os.Getenv(name), models.DefaultCurrency); err == nil {
+		return value
+	}
+	value, _ := models.ParseMoney(def, models.DefaultCurrency)
+	return value
+}
+
+// applyOrderTypeRules defaults the order type to DINE_IN, checks that the
+// fields its type needs are present and sets the delivery fee. Orders that do
+// not name their type keep working without a table, as they did before order
+// types existed.
+func applyOrderTypeRules(fulfilment *models.Fulfilment, tableId *string) error {
+	explicit := fulfilment.Order_type != ""
+	if !explicit {
+		fulfilment.Order_type = "DINE_IN"
+	}
+
+	rule, ok := orderTypeRules[fulfilment.Order_type]
+	if !ok {
+		return fmt.Errorf("unknown order type %s", fulfilment.Order_type)
+	}
+
+	if rule.requiresTable && explicit && tableId == nil {
+		return fmt.Errorf("a table is required for %s orders", fulfilment.Order_type)
+	}
+	if rule.requiresCustomer && (fulfilment.Customer_name == nil || fulfilment.Customer_phone == nil) {
+		return fmt.Errorf("customer name and phone are required for %s orders", fulfilment.Order_type)
+	}
+	if rule.requiresAddress && fulfilment.Delivery_address == nil {
+		return fmt.Errorf("a delivery address is required for %s orders", fulfilment.Order_type)
+	}
+	if rule.requiresRoom && fulfilment.Room_number == nil {
+		return fmt.Errorf("a room number is required for %s orders", fulfilment.Order_type)
+	}
+	if fulfilment.Order_type == "TAKEAWAY" && fulfilment.Pickup_time == nil {
+		return fmt.Errorf("a pickup time is required for TAKEAWAY orders")
+	}
+	if fulfilment.Order_type == "DELIVERY" && fulfilment.Delivery_time == nil {
+		return fmt.Errorf("a delivery time is required for DELIVERY orders")
+	}
+
+	fulfilment.Delivery_fee = rule.deliveryFee
+	return nil
+}
+
+// checkMinimumOrder rejects an order whose item subtotal is below the minimum for its type.
+func checkMinimumOrder(orderType string, subtotal models.Money) error {
+	rule := orderTypeRules[orderType]
+	if subtotal.Amount < rule.minimumOrder.Amount {
+		return fmt.Errorf("%s orders must be at least %s, got %s", orderType, rule.minimumOrder, subtotal)
+	}
+	return nil
+}
+
+// checkOrderMinimum checks the minimum of an order once one of its items
+// changes: the other live items plus the changed line, left out when nil
+// (the item is being voided).
+func checkOrderMinimum(ctx context.Context, orderId, orderItemId string, line *models.Money) error {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+		return errors.New("order was not found")
+	}
+	if orderTypeRules[order.Order_type].minimumOrder.IsZero() {
+		return nil
+	}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{
+		"order_id":       orderId,
+		"order_item_id":  bson.M{"$ne": orderItemId},
+		"voided":         bson.M{"$ne": true},
+		"bundle_item_id": nil,
+	})
+	if err != nil {
+		return errors.New("error occurred while reading the order items")
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return errors.New("error occurred while decoding the order items")
+	}
+
+	subtotal := models.NewMoney(0)
+	if line != nil {
+		subtotal = *line
+	}
+	for _, orderItem := range orderItems {
+		if orderItem.Unit_price != nil && orderItem.Quantity != nil {
+			subtotal = subtotal.Add(orderItem.Unit_price.Mul(*orderItem.Quantity))
+		}
+	}
+	return checkMinimumOrder(order.Order_type, subtotal)
+}
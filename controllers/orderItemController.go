@@ -1,18 +1,26 @@
 package controller
 
 import (
+	"context"
+	"fmt"
 	"golang-Hotel_Management/database"
 	"golang-Hotel_Management/models"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // OrderItemPack is used to structure order item data with a table ID and item list.
 type OrderItemPack struct {
-	Table_id    *string            `json:"table_id"`    // ID of the table placing the order
-	Order_items []models.OrderItem `json:"order_items"` // List of order items
+	Table_id          *string            `json:"table_id"`      // ID of the table placing the order
+	Restaurant_id     *string            `json:"restaurant_id"` // Restaurant the order is placed at; the default one when empty
+	Order_items       []models.OrderItem `json:"order_items"`   // List of order items
+	models.Fulfilment                    // Order type and takeaway/delivery details
 }
 
 // Connect to the "orderItem" collection in MongoDB using the shared client instance.
@@ -21,40 +29,530 @@ var orderItemCollection *mongo.Collection = database.OpenCollection(database.Cli
 // Handler to retrieve all order items.
 func GetOrderItems() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implementation to retrieve all order items goes here
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := orderItemCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing ordered items"})
+			return
+		}
+
+		var allOrderItems []bson.M
+		if err = result.All(ctx, &allOrderItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding ordered items"})
+			return
+		}
+
+		c.JSON(http.StatusOK, allOrderItems)
 	}
 }
 
-// Handler to retrieve a specific order item by its ID.
+// Handler to retrieve all the order items belonging to one order.
 func GetOrderItemByOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implementation to retrieve an order item by order ID
+		orderId := c.Param("order_id")
+
+		allOrderItems, err := ItemsByOrder(orderId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing order items by order ID"})
+			return
+		}
+
+		c.JSON(http.StatusOK, allOrderItems)
 	}
 }
 
-// Logic to get items by order ID (used internally).
+// ItemsByOrder joins the items of an order with their food, order and table
+// documents and groups them into a single summary: the table number, the
+// line items and the amount due (unit price multiplied by quantity per line,
+// plus the delivery fee for delivery and room service orders).
 func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
-	// MongoDB query logic to return items by given order ID
-	return
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	// Voided items are kept for the void report but never billed, and
+	// bundles are billed as a whole rather than by component.
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "order_id", Value: id},
+		{Key: "voided", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "bundle_item_id", Value: nil},
+	}}}
+
+	lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "food"},
+		{Key: "localField", Value: "food_id"},
+		{Key: "foreignField", Value: "food_id"},
+		{Key: "as", Value: "food"},
+	}}}
+	unwindFoodStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$food"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "order"},
+		{Key: "localField", Value: "order_id"},
+		{Key: "foreignField", Value: "order_id"},
+		{Key: "as", Value: "order"},
+	}}}
+	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$order"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "table"},
+		{Key: "localField", Value: "order.table_id"},
+		{Key: "foreignField", Value: "table_id"},
+		{Key: "as", Value: "table"},
+	}}}
+	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$table"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	// The line amount is computed from the stored unit price, which was derived
+	// from the food's price for the chosen size when the item was created.
+	projectStage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "order_item_id", Value: 1},
+		{Key: "food_id", Value: 1},
+		{Key: "food_name", Value: "$food.name"},
+		{Key: "food_image", Value: "$food.food_image"},
+		{Key: "size", Value: 1},
+		{Key: "choices", Value: 1},
+		{Key: "quantity", Value: 1},
+		{Key: "unit_price", Value: 1},
+		{Key: "amount", Value: bson.D{
+			{Key: "amount", Value: bson.D{{Key: "$multiply", Value: bson.A{"$unit_price.amount", "$quantity"}}}},
+			{Key: "currency", Value: "$unit_price.currency"},
+		}},
+		{Key: "order_id", Value: 1},
+		{Key: "table_id", Value: "$table.table_id"},
+		{Key: "table_number", Value: "$table.table_number"},
+		{Key: "order_type", Value: "$order.order_type"},
+		{Key: "delivery_fee", Value: "$order.delivery_fee"},
+	}}}
+
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: bson.D{
+			{Key: "order_id", Value: "$order_id"},
+			{Key: "table_id", Value: "$table_id"},
+			{Key: "table_number", Value: "$table_number"},
+			{Key: "order_type", Value: "$order_type"},
+			{Key: "delivery_fee", Value: "$delivery_fee"},
+		}},
+		{Key: "payment_due", Value: bson.D{{Key: "$sum", Value: "$amount.amount"}}},
+		{Key: "currency", Value: bson.D{{Key: "$first", Value: "$amount.currency"}}},
+		{Key: "total_count", Value: bson.D{{Key: "$sum", Value: "$quantity"}}},
+		{Key: "order_items", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
+	}}}
+
+	projectStage2 := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "payment_due", Value: bson.D{
+			{Key: "amount", Value: bson.D{{Key: "$add", Value: bson.A{
+				"$payment_due",
+				bson.D{{Key: "$ifNull", Value: bson.A{"$_id.delivery_fee.amount", 0}}},
+			}}}},
+			{Key: "currency", Value: "$currency"},
+		}},
+		{Key: "total_count", Value: 1},
+		{Key: "table_number", Value: "$_id.table_number"},
+		{Key: "order_type", Value: "$_id.order_type"},
+		{Key: "delivery_fee", Value: "$_id.delivery_fee"},
+		{Key: "order_items", Value: 1},
+	}}}
+
+	result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+		matchStage,
+		lookupFoodStage,
+		unwindFoodStage,
+		lookupOrderStage,
+		unwindOrderStage,
+		lookupTableStage,
+		unwindTableStage,
+		projectStage,
+		groupStage,
+		projectStage2,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = result.All(ctx, &OrderItems); err != nil {
+		return nil, err
+	}
+
+	return OrderItems, err
 }
 
-// Handler to retrieve a single order item (specific purpose to be defined).
+// Handler to retrieve a single order item by its order_item_id.
 func GetOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implementation for single item fetch
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderItemId := c.Param("orderItem_id")
+		var orderItem models.OrderItem
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the order item"})
+			return
+		}
+
+		c.JSON(http.StatusOK, orderItem)
 	}
 }
 
-// Handler to update an order item.
+// Handler to update an order item. The unit price is re-derived from the food
+// whenever the food or the size changes; a client-supplied price is ignored.
+// Voided items cannot be edited, and what the kitchen already has is changed
+// by voiding it, which needs a manager's approval.
 func UpdateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implementation to update an order item
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var orderItem models.OrderItem
+		var existing models.OrderItem
+
+		orderItemId := c.Param("orderItem_id")
+		filter := bson.M{"order_item_id": orderItemId}
+
+		if err := c.BindJSON(&orderItem); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := orderItemCollection.FindOne(ctx, filter).Decode(&existing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+
+		if existing.Voided {
+			c.JSON(http.StatusConflict, gin.H{"error": "order item is voided"})
+			return
+		}
+		changesDish := orderItem.Quantity != nil || orderItem.Food_id != nil || orderItem.Size != nil || orderItem.Choices != nil
+		if changesDish && existing.Sent_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "order item was already sent to the kitchen; void it and order again instead"})
+			return
+		}
+
+		// Bundles and their components only change together
+		if (existing.Bundle || existing.Bundle_item_id != nil) &&
+			(orderItem.Quantity != nil || orderItem.Food_id != nil || orderItem.Size != nil || orderItem.Choices != nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bundles are changed by voiding them and ordering them again"})
+			return
+		}
+
+		var updateObj primitive.D
+		unitPrice, quantity := existing.Unit_price, existing.Quantity
+
+		if orderItem.Quantity != nil {
+			if err := validate.Var(*orderItem.Quantity, "min=1"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "quantity", Value: *orderItem.Quantity})
+			quantity = orderItem.Quantity
+		}
+
+		if orderItem.Food_id != nil || orderItem.Size != nil {
+			if orderItem.Food_id == nil {
+				orderItem.Food_id = existing.Food_id
+			}
+			if orderItem.Size == nil {
+				orderItem.Size = existing.Size
+			}
+			if orderItem.Size == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "size is required"})
+				return
+			}
+			if err := validate.Var(*orderItem.Size, "eq=S|eq=M|eq=L"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			var food models.Food
+			err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food)
+			if err != nil {
+				msg := fmt.Sprintf("message: Food was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+			if err := refreshFoodPrices(ctx, &food); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if err := checkFoodOnSale(ctx, food, time.Now()); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if food.Bundle != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bundles are ordered as new order items"})
+				return
+			}
+
+			price, err := priceForSize(food, *orderItem.Size)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "food_id", Value: *orderItem.Food_id})
+			updateObj = append(updateObj, bson.E{Key: "size", Value: *orderItem.Size})
+			updateObj = append(updateObj, bson.E{Key: "unit_price", Value: price})
+			unitPrice = &price
+		}
+
+		// A smaller or cheaper line must not take the order below its minimum
+		if (orderItem.Quantity != nil || orderItem.Food_id != nil || orderItem.Size != nil) &&
+			unitPrice != nil && quantity != nil {
+			line := unitPrice.Mul(*quantity)
+			if err := checkOrderMinimum(ctx, existing.Order_id, existing.Order_item_id, &line); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if orderItem.Guest_allergens != nil || orderItem.Allergy_note != nil {
+			if err := validate.StructPartial(orderItem, "Guest_allergens", "Allergy_note"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if orderItem.Guest_allergens == nil {
+				orderItem.Guest_allergens = existing.Guest_allergens
+			}
+			if orderItem.Allergy_note == nil {
+				orderItem.Allergy_note = existing.Allergy_note
+			}
+			// An allergy flagged on the item stays flagged, even when its
+			// details are edited away
+			orderItem.Allergy = existing.Allergy || hasAllergy(orderItem)
+			updateObj = append(updateObj, bson.E{Key: "guest_allergens", Value: orderItem.Guest_allergens})
+			updateObj = append(updateObj, bson.E{Key: "allergy_note", Value: orderItem.Allergy_note})
+			updateObj = append(updateObj, bson.E{Key: "allergy", Value: orderItem.Allergy})
+		}
+
+		// Keep the foods' remaining portions in step with the change
+		reserved, released := portionChanges(existing, orderItem)
+		if err := reservePortions(ctx, reserved); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: orderItem.Updated_at})
+
+		// The item must still be neither voided nor, when the dish changes,
+		// sent to the kitchen
+		filter["voided"] = bson.M{"$ne": true}
+		if changesDish {
+			filter["sent_at"] = nil
+		}
+
+		result, err := orderItemCollection.UpdateOne(
+			ctx,
+			filter,
+			bson.D{{Key: "$set", Value: updateObj}},
+			options.Update(),
+		)
+		if err != nil {
+			releasePortions(ctx, reserved)
+			msg := fmt.Sprintf("order item update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		if result.MatchedCount == 0 {
+			releasePortions(ctx, reserved)
+			c.JSON(http.StatusConflict, gin.H{"error": "order item was voided or sent to the kitchen meanwhile, please try again"})
+			return
+		}
+
+		releasePortions(ctx, released)
+		changeStock(ctx, existing, orderItem)
+		c.JSON(http.StatusOK, result)
 	}
 }
 
-// Handler to create a new order item entry.
+// hasAllergy reports whether an order item carries details of a guest allergy.
+func hasAllergy(orderItem models.OrderItem) bool {
+	return len(orderItem.Guest_allergens) > 0 || (orderItem.Allergy_note != nil && *orderItem.Allergy_note != "")
+}
+
+// portionChanges works out the portions an order item update takes from and
+// gives back to the foods involved.
+func portionChanges(existing, update models.OrderItem) (reserved, released map[string]int) {
+	reserved, released = map[string]int{}, map[string]int{}
+	if existing.Food_id == nil || existing.Quantity == nil || existing.Voided {
+		return reserved, released
+	}
+
+	foodId, quantity := *existing.Food_id, *existing.Quantity
+	if update.Food_id != nil {
+		foodId = *update.Food_id
+	}
+	if update.Quantity != nil {
+		quantity = *update.Quantity
+	}
+
+	switch {
+	case foodId != *existing.Food_id:
+		reserved[foodId] = quantity
+		released[*existing.Food_id] = *existing.Quantity
+	case quantity > *existing.Quantity:
+		reserved[foodId] = quantity - *existing.Quantity
+	case quantity < *existing.Quantity:
+		released[foodId] = *existing.Quantity - quantity
+	}
+	return reserved, released
+}
+
+// Handler to create a new order item entry. A new order is opened for the
+// table and every item in the pack is priced from its food and size.
 func CreateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implementation to create new order item(s)
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var orderItemPack OrderItemPack
+		var order models.Order
+
+		if err := c.BindJSON(&orderItemPack); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(orderItemPack.Order_items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at least one order item is required"})
+			return
+		}
+
+		validationErr := validate.Struct(orderItemPack.Fulfilment)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if err := applyOrderTypeRules(&orderItemPack.Fulfilment, orderItemPack.Table_id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order.Table_id = orderItemPack.Table_id
+		order.Restaurant_id = orderItemPack.Restaurant_id
+		order.Fulfilment = orderItemPack.Fulfilment
+
+		// Price every item before anything is written, so a bad item does not
+		// leave a half-created order behind.
+		orderItemsToBeInserted := []interface{}{}
+		portions := map[string]int{}
+		subtotal := models.NewMoney(0)
+		for _, orderItem := range orderItemPack.Order_items {
+			orderItem.Order_id = "pending"
+
+			validationErr := validate.Struct(orderItem)
+			if validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+
+			var food models.Food
+			err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food)
+			if err != nil {
+				msg := fmt.Sprintf("message: Food was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+			if err := refreshFoodPrices(ctx, &food); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if food.Sold_out {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("food item %s is sold out", food.Food_id)})
+				return
+			}
+			if err := checkFoodOnSale(ctx, food, time.Now()); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			unitPrice, err := priceForSize(food, *orderItem.Size)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			orderItem.Unit_price = &unitPrice
+			subtotal = subtotal.Add(unitPrice.Mul(*orderItem.Quantity))
+			portions[food.Food_id] += *orderItem.Quantity
+
+			// Starters go with the first send; later courses wait to be fired.
+			if orderItem.Course == nil {
+				course := 1
+				orderItem.Course = &course
+			}
+			orderItem.Held = *orderItem.Course > 1
+			orderItem.Allergy = orderItem.Allergy || hasAllergy(orderItem)
+
+			orderItem.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			orderItem.ID = primitive.NewObjectID()
+			orderItem.Order_item_id = orderItem.ID.Hex()
+
+			// A bundle is billed as one line and cooked as its components
+			orderItem.Bundle = food.Bundle != nil
+			if !orderItem.Bundle {
+				orderItem.Choices = nil
+			}
+			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
+			if orderItem.Bundle {
+				components, err := bundleComponents(ctx, food, orderItem)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				for _, component := range components {
+					portions[*component.Food_id] += *component.Quantity
+					orderItemsToBeInserted = append(orderItemsToBeInserted, component)
+				}
+			}
+		}
+
+		if err := checkMinimumOrder(order.Order_type, subtotal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Portions are taken only once the whole pack is known to be valid
+		if err := reservePortions(ctx, portions); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderId := OrderItemOrderCreator(order)
+		for i := range orderItemsToBeInserted {
+			orderItem := orderItemsToBeInserted[i].(models.OrderItem)
+			orderItem.Order_id = orderId
+			orderItemsToBeInserted[i] = orderItem
+		}
+
+		insertedOrderItems, err := orderItemCollection.InsertMany(ctx, orderItemsToBeInserted)
+		if err != nil {
+			releasePortions(ctx, portions)
+			msg := fmt.Sprintf("order items were not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		for _, orderItem := range orderItemsToBeInserted {
+			depleteStock(ctx, orderItem.(models.OrderItem))
+		}
+
+		c.JSON(http.StatusOK, insertedOrderItems)
 	}
 }
@@ -0,0 +1,511 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/middleware"
+	"golang-Hotel_Management/models"
+	"golang-Hotel_Management/payments"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var paymentCollection *mongo.Collection = database.OpenCollection(database.Client, "payment")
+
+// GetInvoicePayments lists the payments taken against an invoice, oldest first.
+func GetInvoicePayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		invoiceId := c.Param("invoice_id")
+
+		invoicePayments, err := paymentsForInvoice(ctx, invoiceId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing payments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, invoicePayments)
+	}
+}
+
+// CreatePayment records one tender against an invoice. For cash, Amount is what
+// the guest handed over: only the balance due is applied and the rest is given
+// back as change. Other tenders are applied in full, so they can overpay.
+// Tip is added on top of Amount on cards and kept out of the cash handed over.
+// Cards sent with a card_token are stored as pending, then authorized and
+// captured through the payment provider; a delayed authorization answers 202
+// and is completed by the provider's webhook.
+func CreatePayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var payment models.Payment
+		var invoice models.Invoice
+
+		invoiceId := c.Param("invoice_id")
+
+		if err := c.BindJSON(&payment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(payment)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// A card with a token is charged through the payment provider; a
+		// reference alone records a payment taken on a standalone terminal.
+		chargeCard := *payment.Method == "CARD" && payment.Card_token != ""
+
+		if *payment.Method != "CASH" && !chargeCard && (payment.Reference == nil || *payment.Reference == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reference is required for " + *payment.Method + " payments"})
+			return
+		}
+
+		if payment.Amount.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than zero"})
+			return
+		}
+
+		err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+
+		if payment.Amount.Currency == "" {
+			payment.Amount.Currency = invoice.Payment_due.Currency
+		}
+		if payment.Amount.Currency != invoice.Payment_due.Currency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("payment currency %s does not match invoice currency %s", payment.Amount.Currency, invoice.Payment_due.Currency)})
+			return
+		}
+		if payment.Tip.Currency == "" {
+			payment.Tip.Currency = payment.Amount.Currency
+		}
+		if payment.Tip.Currency != payment.Amount.Currency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tip currency must match the payment currency"})
+			return
+		}
+
+		if invoice.Voided {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is voided"})
+			return
+		}
+
+		balance := invoice.Payment_due.Sub(invoice.Amount_paid)
+		if balance.Amount <= 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is already paid"})
+			return
+		}
+
+		payment.Tendered = payment.Amount
+		payment.Change = models.Money{Currency: payment.Amount.Currency}
+		if *payment.Method == "CASH" {
+			// A cash tip is kept out of what was handed over before the bill is paid
+			available := payment.Tendered.Sub(payment.Tip)
+			if available.Amount <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cash tendered does not cover the tip"})
+				return
+			}
+			payment.Amount = available.Min(balance)
+			payment.Change = available.Sub(payment.Amount)
+		}
+
+		// The tip is shared out by the rules in force now, however they change later
+		if payment.Tip.Amount > 0 {
+			rules, err := activeTipRules(ctx)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading tip rules"})
+				return
+			}
+			payment.Tip_outs = tipOuts(rules)
+		}
+
+		payment.Invoice_id = invoice.Invoice_id
+		payment.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		payment.Updated_at = payment.Created_at
+		payment.ID = primitive.NewObjectID()
+		payment.Payment_id = payment.ID.Hex()
+		payment.Status = payments.StatusCaptured
+		if chargeCard {
+			// Stored before the provider is called, so that a charged card
+			// always has a payment to show for it
+			payment.Status = payments.StatusPending
+		}
+
+		if _, insertErr := paymentCollection.InsertOne(ctx, payment); insertErr != nil {
+			msg := fmt.Sprintf("payment was not recorded")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if chargeCard {
+			chargeErr := chargePayment(ctx, &payment)
+			// Once the provider holds money for it, a retry must not charge again
+			if payment.Transaction_id != "" {
+				middleware.CommitSideEffects(c)
+			}
+			if err := storeCharge(ctx, payment); err != nil {
+				log.Println("payment", payment.Payment_id, "ended as", payment.Transaction_id, payment.Status, "but was not updated:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the card payment went to the provider but its outcome was not stored", "payment": payment})
+				return
+			}
+			if chargeErr != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": chargeErr.Error(), "payment": payment})
+				return
+			}
+			if payment.Status == payments.StatusVoided {
+				c.JSON(http.StatusBadGateway, gin.H{"error": payment.Decline_reason, "payment": payment})
+				return
+			}
+		} else {
+			middleware.CommitSideEffects(c)
+		}
+
+		// Declined payments are kept for the audit trail but change nothing on the invoice
+		if payment.Status == payments.StatusDeclined {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "payment was declined: " + payment.Decline_reason, "payment": payment})
+			return
+		}
+		if payment.Status == payments.StatusPending {
+			c.JSON(http.StatusAccepted, payment)
+			return
+		}
+
+		if err := applyInvoicePayments(ctx, invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, payment)
+	}
+}
+
+// paymentsForInvoice reads the payments of an invoice, oldest first.
+func paymentsForInvoice(ctx context.Context, invoiceId string) ([]models.Payment, error) {
+	cursor, err := paymentCollection.Find(ctx, bson.M{"invoice_id": invoiceId})
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []models.Payment{}
+	if err = cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// paymentStatus derives an invoice's status from what has been paid and
+// refunded against what is due. Any refund takes precedence over payment.
+func paymentStatus(paid, refunded, due models.Money) string {
+	switch {
+	case refunded.Amount > 0 && refunded.Amount >= paid.Amount:
+		return "REFUNDED"
+	case refunded.Amount > 0:
+		return "PARTIALLY_REFUNDED"
+	case paid.Amount == 0:
+		return "PENDING"
+	case paid.Amount < due.Amount:
+		return "PARTIALLY_PAID"
+	case paid.Amount == due.Amount:
+		return "PAID"
+	default:
+		return "OVERPAID"
+	}
+}
+
+// paymentCounts reports whether a payment's money was actually taken.
+// Payments recorded before providers existed carry no status. A refunded
+// capture still counts: what was paid back is tracked in its Refunded amount.
+func paymentCounts(payment models.Payment) bool {
+	return payment.Status == payments.StatusCaptured || payment.Status == payments.StatusRefunded || payment.Status == ""
+}
+
+// applyInvoicePayments recomputes the amounts paid and refunded, balance and
+// status of an invoice from all of its payments, and settles the order once
+// it is paid.
+// Totals are always rebuilt from the payments so that concurrent tenders
+// cannot overwrite each other's amounts.
+func applyInvoicePayments(ctx context.Context, invoice models.Invoice) error {
+	invoicePayments, err := paymentsForInvoice(ctx, invoice.Invoice_id)
+	if err != nil {
+		return errors.New("error occurred while reading payments")
+	}
+
+	paid := models.Money{Currency: invoice.Payment_due.Currency}
+	refunded := models.Money{Currency: invoice.Payment_due.Currency}
+	for _, payment := range invoicePayments {
+		if paymentCounts(payment) {
+			paid = paid.Add(payment.Amount)
+			refunded = refunded.Add(payment.Refunded)
+		}
+	}
+	status := paymentStatus(paid, refunded, invoice.Payment_due)
+
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err = invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoice.Invoice_id}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "amount_paid", Value: paid},
+		{Key: "balance_due", Value: invoice.Payment_due.Sub(paid)},
+		{Key: "amount_refunded", Value: refunded},
+		{Key: "payment_status", Value: status},
+		{Key: "updated_at", Value: updatedAt},
+	}}})
+	if err != nil {
+		return errors.New("invoice payment status update failed")
+	}
+
+	if status == "PAID" || status == "OVERPAID" {
+		if err := settleOrderIfPaid(ctx, invoice.Order_id); err != nil {
+			return errors.New("order could not be settled")
+		}
+	}
+	return nil
+}
+
+// chargePayment authorizes a card payment with the default provider and
+// captures it straight away when approved. A payment the provider could not
+// be asked about is marked declined.
+func chargePayment(ctx context.Context, payment *models.Payment) error {
+	provider, err := payments.Default()
+	if err == nil {
+		var result payments.Result
+		result, err = provider.Authorize(ctx, payments.AuthorizeRequest{
+			Amount:     payment.Amount.Add(payment.Tip),
+			Card_token: payment.Card_token,
+			Reference:  payment.Invoice_id,
+		})
+		if err == nil {
+			payment.Provider = provider.Name()
+			payment.Transaction_id = result.Transaction_id
+			payment.Reference = &result.Transaction_id
+			return applyProviderResult(ctx, provider, payment, result)
+		}
+		err = fmt.Errorf("payment provider error: %w", err)
+	}
+
+	payment.Status = payments.StatusDeclined
+	payment.Decline_reason = err.Error()
+	payment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// storeCharge saves what the provider made of a card payment stored as pending.
+func storeCharge(ctx context.Context, payment models.Payment) error {
+	_, err := paymentCollection.UpdateOne(ctx, bson.M{"payment_id": payment.Payment_id}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "provider", Value: payment.Provider},
+		{Key: "transaction_id", Value: payment.Transaction_id},
+		{Key: "reference", Value: payment.Reference},
+		{Key: "status", Value: payment.Status},
+		{Key: "decline_reason", Value: payment.Decline_reason},
+		{Key: "updated_at", Value: payment.Updated_at},
+	}}})
+	return err
+}
+
+// applyProviderResult copies a provider's view of a transaction onto the
+// payment, capturing it if the provider has only authorized it so far. An
+// authorization that cannot be captured is voided, so that no money is held
+// for a payment that did not go through.
+func applyProviderResult(ctx context.Context, provider payments.Provider, payment *models.Payment, result payments.Result) error {
+	if result.Status == payments.StatusAuthorized {
+		captured, err := provider.Capture(ctx, result.Transaction_id, payment.Amount.Add(payment.Tip))
+		if err != nil {
+			voided, voidErr := provider.Void(ctx, result.Transaction_id)
+			if voidErr != nil {
+				payment.Status = payments.StatusAuthorized
+				payment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+				return fmt.Errorf("payment capture failed and the authorization could not be voided: %w", err)
+			}
+			voided.Status = payments.StatusVoided
+			voided.Decline_reason = fmt.Sprintf("payment capture failed, the authorization was voided: %v", err)
+			result = voided
+		} else {
+			result = captured
+		}
+	}
+
+	// A refund leaves the payment captured; the amount paid back is in
+	// Refunded, recorded when the refund was made.
+	if result.Status == payments.StatusRefunded && payment.Status == payments.StatusCaptured {
+		result.Status = payments.StatusCaptured
+	}
+
+	payment.Status = result.Status
+	payment.Decline_reason = result.Decline_reason
+	payment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return nil
+}
+
+// updatePaymentStatus stores a payment's new status and brings its invoice up to date.
+func updatePaymentStatus(ctx context.Context, payment models.Payment) error {
+	_, err := paymentCollection.UpdateOne(ctx, bson.M{"payment_id": payment.Payment_id}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: payment.Status},
+		{Key: "decline_reason", Value: payment.Decline_reason},
+		{Key: "updated_at", Value: payment.Updated_at},
+	}}})
+	if err != nil {
+		return errors.New("payment status update failed")
+	}
+
+	var invoice models.Invoice
+	if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": payment.Invoice_id}).Decode(&invoice); err != nil {
+		return errors.New("invoice was not found")
+	}
+	return applyInvoicePayments(ctx, invoice)
+}
+
+// providerPayment loads a payment that went through a provider, with that provider.
+func providerPayment(ctx context.Context, paymentId string) (models.Payment, payments.Provider, error) {
+	var payment models.Payment
+	if err := paymentCollection.FindOne(ctx, bson.M{"payment_id": paymentId}).Decode(&payment); err != nil {
+		return payment, nil, errors.New("payment was not found")
+	}
+	if payment.Provider == "" {
+		return payment, nil, errors.New("payment was not taken through a payment provider")
+	}
+	provider, err := payments.Get(payment.Provider)
+	return payment, provider, err
+}
+
+// GetPaymentStatus asks the provider for the current status of a card payment
+// and stores it, for when a webhook was missed.
+func GetPaymentStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		payment, provider, err := providerPayment(ctx, c.Param("payment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := provider.Status(ctx, payment.Transaction_id)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.Status != payment.Status {
+			if err := applyProviderResult(ctx, provider, &payment, result); err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+			if err := updatePaymentStatus(ctx, payment); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, payment)
+	}
+}
+
+// VoidPayment cancels a card payment with its provider and takes it off the invoice.
+func VoidPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		payment, provider, err := providerPayment(ctx, c.Param("payment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if payment.Status == payments.StatusVoided || payment.Status == payments.StatusDeclined {
+			c.JSON(http.StatusConflict, gin.H{"error": "payment is already " + payment.Status})
+			return
+		}
+
+		result, err := provider.Void(ctx, payment.Transaction_id)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		payment.Status = result.Status
+		payment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if err := updatePaymentStatus(ctx, payment); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, payment)
+	}
+}
+
+// PaymentWebhook receives status changes from a payment provider. The body
+// must carry a valid signature; the matching payment and its invoice are
+// then brought up to date.
+func PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		provider, err := payments.Get(c.Param("provider"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		payload, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "request body could not be read"})
+			return
+		}
+
+		event, err := provider.ParseWebhook(payload, c.GetHeader(payments.SignatureHeader))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var payment models.Payment
+		err = paymentCollection.FindOne(ctx, bson.M{
+			"provider":       provider.Name(),
+			"transaction_id": event.Transaction_id,
+		}).Decode(&payment)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "payment was not found"})
+			return
+		}
+
+		// Providers retry webhooks, so a status already applied is acknowledged as is
+		if event.Status == payment.Status {
+			c.JSON(http.StatusOK, payment)
+			return
+		}
+
+		result := payments.Result{
+			Transaction_id: event.Transaction_id,
+			Status:         event.Status,
+			Amount:         event.Amount,
+			Decline_reason: event.Decline_reason,
+		}
+		if err := applyProviderResult(ctx, provider, &payment, result); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		if err := updatePaymentStatus(ctx, payment); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, payment)
+	}
+}
@@ -0,0 +1,486 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var priceChangeCollection *mongo.Collection = database.OpenCollection(database.Client, "priceChange")
+
+// PriceChangeRequest is the body of CreatePriceChange. Without an
+// Effective_from the change applies straight away.
+type PriceChangeRequest struct {
+	Price          *models.Money           `json:"price"`
+	Size_prices    map[string]models.Money `json:"size_prices" validate:"omitempty,dive,keys,eq=S|eq=M|eq=L,endkeys"`
+	Effective_from *time.Time              `json:"effective_from"`
+	Changed_by     *string                 `json:"changed_by" validate:"required"`
+	Reason         *string                 `json:"reason" validate:"omitempty,max=200"`
+}
+
+// CancelPriceChangeRequest is the body of CancelPriceChange.
+type CancelPriceChangeRequest struct {
+	Cancelled_by *string `json:"cancelled_by" validate:"required"`
+}
+
+// FoodPriceAt is what a food cost at a moment in its price history.
+type FoodPriceAt struct {
+	Food_id         string                  `json:"food_id"`
+	At              time.Time               `json:"at"`
+	Price           *models.Money           `json:"price"`
+	Size_prices     map[string]models.Money `json:"size_prices"`
+	Price_change_id string                  `json:"price_change_id"` // Change that set the regular price
+}
+
+// GetFoodPrices returns a food's price history, newest first, optionally only
+// the changes with a given "status". With "at" (RFC3339) it instead returns
+// the prices that were in effect at that moment.
+func GetFoodPrices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+
+		if _, err := applyDuePriceChanges(ctx, foodId); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if value := c.Query("at"); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			prices, err := foodPriceAt(ctx, foodId, at)
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no price was recorded for this food at that time"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, prices)
+			return
+		}
+
+		filter := bson.M{"food_id": foodId}
+		if status := c.Query("status"); status != "" {
+			if err := validate.Var(status, "eq=SCHEDULED|eq=APPLIED|eq=CANCELLED|eq=FAILED"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter["status"] = status
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: -1}, {Key: "created_at", Value: -1}})
+		result, err := priceChangeCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing price changes"})
+			return
+		}
+
+		changes := []models.PriceChange{}
+		if err = result.All(ctx, &changes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding price changes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, changes)
+	}
+}
+
+// CreatePriceChange records a new price for a food, applied at once or
+// scheduled for its effective time.
+func CreatePriceChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PriceChangeRequest
+
+		foodId := c.Param("food_id")
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(request)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if request.Price == nil && request.Size_prices == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a price or size prices are required"})
+			return
+		}
+
+		prices := models.Food{Price: request.Price, Size_prices: request.Size_prices}
+		if err := normalizeFoodPrices(&prices); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if prices.Price != nil {
+			if err := validate.Struct(prices.Price); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := checkPricesCharged(prices); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if food.Archived {
+			c.JSON(http.StatusConflict, gin.H{"error": "food is no longer on the menu"})
+			return
+		}
+		if food.Menu_id != nil {
+			if status, err := checkMenuEditable(ctx, *food.Menu_id); err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// History is only ever added to: a change cannot take effect in the past.
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		effectiveFrom := now
+		if request.Effective_from != nil {
+			if request.Effective_from.Before(now.Add(-time.Minute)) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from cannot be in the past"})
+				return
+			}
+			if request.Effective_from.After(now) {
+				effectiveFrom = request.Effective_from.UTC()
+			}
+		}
+
+		change := models.PriceChange{
+			Food_id:        foodId,
+			Price:          prices.Price,
+			Size_prices:    prices.Size_prices,
+			Effective_from: effectiveFrom,
+			Status:         "SCHEDULED",
+			Changed_by:     request.Changed_by,
+			Reason:         request.Reason,
+			Created_at:     now,
+		}
+		change.ID = primitive.NewObjectID()
+		change.Price_change_id = change.ID.Hex()
+
+		if _, err := priceChangeCollection.InsertOne(ctx, change); err != nil {
+			msg := fmt.Sprintf("Price change was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if !effectiveFrom.After(now) {
+			if _, err := applyDuePriceChanges(ctx, foodId); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if err := priceChangeCollection.FindOne(ctx, bson.M{"price_change_id": change.Price_change_id}).Decode(&change); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the price change"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, change)
+	}
+}
+
+// checkPricesCharged refuses prices of zero, which would put a food on sale
+// for nothing the moment they apply.
+func checkPricesCharged(food models.Food) error {
+	if food.Price != nil && food.Price.Amount <= 0 {
+		return errors.New("price must be greater than zero")
+	}
+	for size, price := range food.Size_prices {
+		if price.Amount <= 0 {
+			return fmt.Errorf("price of size %s must be greater than zero", size)
+		}
+	}
+	return nil
+}
+
+// CancelPriceChange withdraws a price change that has not taken effect yet.
+func CancelPriceChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request CancelPriceChangeRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(request)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		cancelledAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := priceChangeCollection.UpdateOne(
+			ctx,
+			bson.M{
+				"price_change_id": c.Param("price_change_id"),
+				"food_id":         c.Param("food_id"),
+				"status":          "SCHEDULED",
+				"effective_from":  bson.M{"$gt": cancelledAt},
+			},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "status", Value: "CANCELLED"},
+				{Key: "cancelled_by", Value: request.Cancelled_by},
+				{Key: "cancelled_at", Value: cancelledAt},
+			}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "price change cancel failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "only price changes that have not taken effect can be cancelled"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// foodPriceAt works out a food's prices at a moment from its applied changes.
+// A change may set only the regular price or only the size prices, so each
+// comes from the latest change that set it.
+func foodPriceAt(ctx context.Context, foodId string, at time.Time) (FoodPriceAt, error) {
+	prices := FoodPriceAt{Food_id: foodId, At: at}
+	opts := options.FindOne().SetSort(bson.D{{Key: "effective_from", Value: -1}, {Key: "applied_at", Value: -1}})
+	filter := bson.M{"food_id": foodId, "status": "APPLIED", "effective_from": bson.M{"$lte": at}}
+
+	var change models.PriceChange
+	filter["price"] = bson.M{"$ne": nil}
+	if err := priceChangeCollection.FindOne(ctx, filter, opts).Decode(&change); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return prices, err
+		}
+		return prices, errors.New("error occurred while reading the price history")
+	}
+	prices.Price = change.Price
+	prices.Price_change_id = change.Price_change_id
+
+	change = models.PriceChange{}
+	delete(filter, "price")
+	filter["size_prices"] = bson.M{"$ne": nil}
+	err := priceChangeCollection.FindOne(ctx, filter, opts).Decode(&change)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return prices, errors.New("error occurred while reading the price history")
+	}
+	prices.Size_prices = change.Size_prices
+
+	return prices, nil
+}
+
+// applyDuePriceChanges applies the scheduled changes whose time has come, in
+// the order they take effect, for one food or for all foods when foodId is
+// empty. It returns how many it applied. A change that cannot be applied does
+// not hold up the others: it is logged and retried on the next run, or marked
+// FAILED when its food no longer exists. The first such error is returned.
+func applyDuePriceChanges(ctx context.Context, foodId string) (int, error) {
+	filter := bson.M{"status": "SCHEDULED", "effective_from": bson.M{"$lte": time.Now()}}
+	if foodId != "" {
+		filter["food_id"] = foodId
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: 1}, {Key: "created_at", Value: 1}})
+	result, err := priceChangeCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, errors.New("error occurred while listing due price changes")
+	}
+	var changes []models.PriceChange
+	if err = result.All(ctx, &changes); err != nil {
+		return 0, errors.New("error occurred while decoding due price changes")
+	}
+
+	applied := 0
+	var firstErr error
+	for _, change := range changes {
+		ok, err := applyPriceChange(ctx, change)
+		if err == errPriceChangeFoodMissing {
+			failPriceChange(ctx, change, err.Error())
+			continue
+		}
+		if err != nil {
+			log.Println("price change", change.Price_change_id, "was not applied:", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ok {
+			applied++
+		}
+	}
+	return applied, firstErr
+}
+
+var errPriceChangeFoodMissing = errors.New("the food no longer exists")
+
+// failPriceChange marks a due change that can never be applied as FAILED so
+// the scheduler stops picking it up.
+func failPriceChange(ctx context.Context, change models.PriceChange, reason string) {
+	_, err := priceChangeCollection.UpdateOne(
+		ctx,
+		bson.M{"price_change_id": change.Price_change_id, "status": "SCHEDULED"},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: "FAILED"},
+			{Key: "failure_reason", Value: reason},
+		}}},
+	)
+	if err != nil {
+		log.Println("price change", change.Price_change_id, "could not be marked failed:", err)
+		return
+	}
+	log.Println("price change", change.Price_change_id, "failed:", reason)
+}
+
+// applyPriceChange claims a scheduled change and copies its prices onto the
+// food. The claim makes sure the scheduler and an order arriving at the same
+// moment do not both apply it, and the food only takes prices newer than the
+// ones it has.
+func applyPriceChange(ctx context.Context, change models.PriceChange) (bool, error) {
+	var food models.Food
+	err := foodCollection.FindOne(ctx, bson.M{"food_id": change.Food_id}).Decode(&food)
+	if err == mongo.ErrNoDocuments {
+		return false, errPriceChangeFoodMissing
+	}
+	if err != nil {
+		return false, fmt.Errorf("food item %s could not be read", change.Food_id)
+	}
+
+	appliedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	claim := bson.D{
+		{Key: "status", Value: "APPLIED"},
+		{Key: "applied_at", Value: appliedAt},
+	}
+	if change.Price != nil {
+		claim = append(claim, bson.E{Key: "previous_price", Value: food.Price})
+	}
+	if change.Size_prices != nil {
+		claim = append(claim, bson.E{Key: "previous_size_prices", Value: food.Size_prices})
+	}
+	result, err := priceChangeCollection.UpdateOne(
+		ctx,
+		bson.M{"price_change_id": change.Price_change_id, "status": "SCHEDULED"},
+		bson.D{{Key: "$set", Value: claim}},
+	)
+	if err != nil {
+		return false, errors.New("error occurred while applying a price change")
+	}
+	if result.ModifiedCount == 0 {
+		return false, nil
+	}
+
+	updateObj := bson.D{
+		{Key: "price_effective_from", Value: change.Effective_from},
+		{Key: "updated_at", Value: appliedAt},
+	}
+	if change.Price != nil {
+		updateObj = append(updateObj, bson.E{Key: "price", Value: change.Price})
+	}
+	if change.Size_prices != nil {
+		updateObj = append(updateObj, bson.E{Key: "size_prices", Value: change.Size_prices})
+	}
+	_, err = foodCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"food_id": change.Food_id,
+			"$or": bson.A{
+				bson.M{"price_effective_from": nil},
+				bson.M{"price_effective_from": bson.M{"$lte": change.Effective_from}},
+			},
+		},
+		bson.D{{Key: "$set", Value: updateObj}},
+	)
+	if err != nil {
+		// Leave the change for the next run rather than recording a price the food never had
+		priceChangeCollection.UpdateOne(
+			ctx,
+			bson.M{"price_change_id": change.Price_change_id},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "SCHEDULED"}, {Key: "applied_at", Value: nil}}}},
+		)
+		return false, errors.New("food price update failed")
+	}
+	return true, nil
+}
+
+// refreshFoodPrices applies any price change that has come due for a food
+// since the scheduler last ran, so that an order is always priced at the
+// price in effect when it is taken.
+func refreshFoodPrices(ctx context.Context, food *models.Food) error {
+	applied, err := applyDuePriceChanges(ctx, food.Food_id)
+	if err != nil || applied == 0 {
+		return err
+	}
+	return foodCollection.FindOne(ctx, bson.M{"food_id": food.Food_id}).Decode(food)
+}
+
+// StartPriceScheduler applies scheduled price changes every interval in the
+// background.
+func StartPriceScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			applied, err := applyDuePriceChanges(ctx, "")
+			if err != nil {
+				log.Println("some scheduled price changes were not applied:", err)
+			}
+			if applied > 0 {
+				log.Println("applied", applied, "scheduled price changes")
+			}
+			cancel()
+		}
+	}()
+}
+
+// recordInitialPrice starts the price history of a new food.
+func recordInitialPrice(ctx context.Context, food models.Food) error {
+	reason := "price when the food was created"
+	change := models.PriceChange{
+		Food_id:        food.Food_id,
+		Price:          food.Price,
+		Size_prices:    food.Size_prices,
+		Effective_from: food.Created_at,
+		Status:         "APPLIED",
+		Changed_by:     food.Created_by,
+		Reason:         &reason,
+		Applied_at:     &food.Created_at,
+		Created_at:     food.Created_at,
+	}
+	change.ID = primitive.NewObjectID()
+	change.Price_change_id = change.ID.Hex()
+
+	_, err := priceChangeCollection.InsertOne(ctx, change)
+	return err
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"golang-Hotel_Management/models"
+	"golang-Hotel_Management/receipts"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetInvoicePDF renders an invoice as a PDF with the restaurant's branding.
+func GetInvoicePDF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		receipt, err := receiptForInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		var pdf bytes.Buffer
+		if err := receipts.RenderPDF(&pdf, receipt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice PDF could not be rendered"})
+			return
+		}
+
+		c.Header("Content-Disposition", `inline; filename="invoice-`+receipt.Invoice.Invoice_id+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", pdf.Bytes())
+	}
+}
+
+// GetInvoiceReceipt renders an invoice for a thermal receipt printer. The
+// "width" query parameter picks 58 or 80 mm paper, defaulting to the
+// restaurant's setting, and "format=text" leaves out the ESC/POS commands.
+func GetInvoiceReceipt() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		receipt, err := receiptForInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		paperWidth := receipt.PaperWidth()
+		if width := c.Query("width"); width != "" {
+			if paperWidth, err = strconv.Atoi(width); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "width must be 58 or 80"})
+				return
+			}
+		}
+
+		plainText := c.Query("format") == "text"
+
+		var output bytes.Buffer
+		if err := receipts.RenderESCPOS(&output, receipt, paperWidth, !plainText); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		contentType := "application/vnd.escpos"
+		if plainText {
+			contentType = "text/plain; charset=utf-8"
+		}
+		c.Data(http.StatusOK, contentType, output.Bytes())
+	}
+}
+
+// receiptForInvoice gathers the invoice, its restaurant and the payments taken on it.
+func receiptForInvoice(ctx context.Context, invoiceId string) (receipts.Receipt, error) {
+	var receipt receipts.Receipt
+
+	err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&receipt.Invoice)
+	if err != nil {
+		return receipt, errors.New("invoice was not found")
+	}
+
+	var restaurantId *string
+	if receipt.Invoice.Restaurant_id != "" {
+		restaurantId = &receipt.Invoice.Restaurant_id
+	}
+	if receipt.Restaurant, err = restaurantForOrder(ctx, restaurantId); err != nil {
+		return receipt, errors.New("restaurant was not found")
+	}
+
+	invoicePayments, err := paymentsForInvoice(ctx, invoiceId)
+	if err != nil {
+		return receipt, errors.New("error occurred while reading payments")
+	}
+	receipt.Payments = []models.Payment{}
+	for _, payment := range invoicePayments {
+		if paymentCounts(payment) {
+			receipt.Payments = append(receipt.Payments, payment)
+		}
+	}
+	return receipt, nil
+}
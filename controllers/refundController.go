@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/middleware"
+	"golang-Hotel_Management/models"
+	"golang-Hotel_Management/payments"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var creditNoteCollection *mongo.Collection = database.OpenCollection(database.Client, "creditNote")
+
+// RefundRequest is the body of RefundInvoice. Leaving out Amount refunds
+// everything still refundable. Every refund needs a manager's approval.
+type RefundRequest struct {
+	Amount      *models.Money `json:"amount"`
+	Reason      *string       `json:"reason" validate:"required"`
+	Staff_id    *string       `json:"staff_id" validate:"required"`
+	Manager_id  *string       `json:"manager_id" validate:"required"`
+	Manager_pin *string       `json:"manager_pin" validate:"required"`
+}
+
+// RefundInvoice gives money back against a paid invoice and issues a credit
+// note for it. The refund is paid back through the invoice's own payments,
+// newest first; card payments are refunded through their provider. The
+// credit note is numbered and stored as PENDING before any money moves, so
+// that every refund has one and no number is lost; it is ISSUED with what was
+// refunded, or VOIDED if nothing could be.
+func RefundInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var refundRequest RefundRequest
+		var invoice models.Invoice
+
+		invoiceId := c.Param("invoice_id")
+
+		if err := c.BindJSON(&refundRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(refundRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if err := verifyManagerApproval(ctx, refundRequest.Manager_id, refundRequest.Manager_pin); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+
+		invoicePayments, err := paymentsForInvoice(ctx, invoice.Invoice_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading payments"})
+			return
+		}
+
+		refundable := models.Money{Currency: invoice.Payment_due.Currency}
+		for _, payment := range invoicePayments {
+			if paymentCounts(payment) {
+				refundable = refundable.Add(payment.Amount).Sub(payment.Refunded)
+			}
+		}
+		if refundable.Amount <= 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice has nothing left to refund"})
+			return
+		}
+
+		amount := refundable
+		if refundRequest.Amount != nil {
+			amount = *refundRequest.Amount
+			if amount.Currency == "" {
+				amount.Currency = refundable.Currency
+			}
+			if amount.Currency != refundable.Currency {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("refund currency %s does not match invoice currency %s", amount.Currency, refundable.Currency)})
+				return
+			}
+			if amount.Amount <= 0 || amount.Amount > refundable.Amount {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("refund amount must be between 0.01 and %s", refundable)})
+				return
+			}
+		}
+
+		var restaurantId *string
+		if invoice.Restaurant_id != "" {
+			restaurantId = &invoice.Restaurant_id
+		}
+		restaurant, err := restaurantForOrder(ctx, restaurantId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "restaurant was not found"})
+			return
+		}
+
+		number, err := allocateNumber(ctx, CreditNoteSequence, restaurant)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var creditNote models.CreditNote
+		creditNote.Number = number.Number
+		creditNote.Fiscal_year = number.Fiscal_year
+		creditNote.Sequence = number.Sequence
+		creditNote.Invoice_id = invoice.Invoice_id
+		creditNote.Order_id = invoice.Order_id
+		creditNote.Restaurant_id = invoice.Restaurant_id
+		creditNote.Reason = *refundRequest.Reason
+		creditNote.Staff_id = *refundRequest.Staff_id
+		creditNote.Approved_by = *refundRequest.Manager_id
+		creditNote.Amount = models.Money{Currency: amount.Currency}
+		creditNote.Taxes = []models.TaxLine{}
+		creditNote.Refunds = []models.Refund{}
+		creditNote.Status = "PENDING"
+		creditNote.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		creditNote.Updated_at = creditNote.Created_at
+		creditNote.ID = primitive.NewObjectID()
+		creditNote.Credit_note_id = creditNote.ID.Hex()
+
+		if _, insertErr := creditNoteCollection.InsertOne(ctx, creditNote); insertErr != nil {
+			log.Println("credit note", creditNote.Number, "was not stored:", insertErr)
+			msg := fmt.Sprintf("credit note was not created; nothing was refunded")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		refunds, refundErr := refundPayments(ctx, invoicePayments, amount)
+		refunded := models.Money{Currency: amount.Currency}
+		for _, refund := range refunds {
+			refunded = refunded.Add(refund.Amount)
+		}
+
+		// Nothing was paid back: the credit note is kept, voided, for its number
+		if refundErr != nil && refunded.IsZero() {
+			reason := "not issued: " + refundErr.Error()
+			creditNote.Status = "VOIDED"
+			creditNote.Voided = true
+			creditNote.Void_reason = &reason
+			if err := finaliseCreditNote(ctx, &creditNote); err != nil {
+				log.Println("credit note", creditNote.Number, "could not be voided:", err)
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": refundErr.Error()})
+			return
+		}
+		// Money has gone back: a retry must not refund it again
+		middleware.CommitSideEffects(c)
+
+		creditNote.Status = "ISSUED"
+		creditNote.Full = refunded.Amount == refundable.Amount && invoice.Amount_refunded.IsZero()
+		creditNote.Amount = refunded
+		creditNote.Taxes = creditedTaxes(invoice, refunded)
+		creditNote.Refunds = refunds
+		if err := finaliseCreditNote(ctx, &creditNote); err != nil {
+			log.Println("credit note", creditNote.Number, "stayed pending after refunding", refunded, "in", refunds, ":", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "refund was made but its credit note was not completed", "credit_note": creditNote})
+			return
+		}
+
+		if err := applyInvoicePayments(ctx, invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Part of the refund went through before the provider failed
+		if refundErr != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": refundErr.Error(), "credit_note": creditNote})
+			return
+		}
+
+		c.JSON(http.StatusOK, creditNote)
+	}
+}
+
+// finaliseCreditNote stores the outcome of the refund a pending credit note
+// was created for.
+func finaliseCreditNote(ctx context.Context, creditNote *models.CreditNote) error {
+	creditNote.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := creditNoteCollection.UpdateOne(ctx, bson.M{"credit_note_id": creditNote.Credit_note_id, "status": "PENDING"}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: creditNote.Status},
+		{Key: "voided", Value: creditNote.Voided},
+		{Key: "void_reason", Value: creditNote.Void_reason},
+		{Key: "full", Value: creditNote.Full},
+		{Key: "amount", Value: creditNote.Amount},
+		{Key: "taxes", Value: creditNote.Taxes},
+		{Key: "refunds", Value: creditNote.Refunds},
+		{Key: "updated_at", Value: creditNote.Updated_at},
+	}}})
+	return err
+}
+
+// refundPayments pays amount back through the given payments, newest first,
+// and records what each of them refunded. It stops at the first provider
+// error and returns what was refunded until then.
+func refundPayments(ctx context.Context, invoicePayments []models.Payment, amount models.Money) ([]models.Refund, error) {
+	var refunds []models.Refund
+	remaining := amount
+
+	for i := len(invoicePayments) - 1; i >= 0 && remaining.Amount > 0; i-- {
+		payment := invoicePayments[i]
+		if !paymentCounts(payment) {
+			continue
+		}
+
+		share := payment.Amount.Sub(payment.Refunded).Min(remaining)
+		if share.Amount <= 0 {
+			continue
+		}
+
+		refund := models.Refund{
+			Payment_id:     payment.Payment_id,
+			Method:         *payment.Method,
+			Amount:         share,
+			Provider:       payment.Provider,
+			Transaction_id: payment.Transaction_id,
+		}
+
+		// The share is claimed before the provider is asked, and only while it
+		// still fits in what was captured, so two refunds made at the same
+		// time cannot both pay back the same money.
+		if err := claimRefund(ctx, payment, share.Amount); err != nil {
+			return refunds, err
+		}
+
+		if payment.Provider != "" {
+			provider, err := payments.Get(payment.Provider)
+			if err == nil {
+				_, err = provider.Refund(ctx, payment.Transaction_id, share)
+				if err != nil {
+					err = fmt.Errorf("payment provider refund failed: %w", err)
+				}
+			}
+			if err != nil {
+				if releaseErr := claimRefund(ctx, payment, -share.Amount); releaseErr != nil {
+					log.Println("refund claim on payment", payment.Payment_id, "was not released:", releaseErr)
+				}
+				return refunds, err
+			}
+		}
+
+		refunds = append(refunds, refund)
+		remaining = remaining.Sub(share)
+	}
+	return refunds, nil
+}
+
+// creditedTaxes works out the share of each of the invoice's taxes contained
+// in a refund, in proportion to the refund's part of the grand total.
+func creditedTaxes(invoice models.Invoice, refunded models.Money) []models.TaxLine {
+	credited := refunded.Min(invoice.Grand_total)
+	weights := []int64{credited.Amount, invoice.Grand_total.Amount - credited.Amount}
+
+	taxes := make([]models.TaxLine, len(invoice.Taxes))
+	for i, tax := range invoice.Taxes {
+		taxes[i] = tax
+		taxes[i].Taxable = tax.Taxable.Allocate(weights)[0]
+		taxes[i].Amount = tax.Amount.Allocate(weights)[0]
+	}
+	return taxes
+}
+
+// GetCreditNotes lists credit notes, newest first, optionally for one invoice
+// given by the "invoice_id" query parameter.
+func GetCreditNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if invoiceId := c.Query("invoice_id"); invoiceId != "" {
+			filter["invoice_id"] = invoiceId
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		result, err := creditNoteCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing credit notes"})
+			return
+		}
+
+		creditNotes := []models.CreditNote{}
+		if err = result.All(ctx, &creditNotes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding credit notes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, creditNotes)
+	}
+}
+
+// GetCreditNote returns a single credit note.
+func GetCreditNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var creditNote models.CreditNote
+
+		err := creditNoteCollection.FindOne(ctx, bson.M{"credit_note_id": c.Param("credit_note_id")}).Decode(&creditNote)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "credit note was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, creditNote)
+	}
+}
+
+// claimRefund adds amount (negative to give it back) to what a payment has
+// refunded, provided the total stays within the amount captured.
+func claimRefund(ctx context.Context, payment models.Payment, amount int64) error {
+	refunded := bson.D{{Key: "$ifNull", Value: bson.A{"$refunded.amount", 0}}}
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := paymentCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"payment_id": payment.Payment_id,
+			"$expr": bson.D{{Key: "$lte", Value: bson.A{
+				bson.D{{Key: "$add", Value: bson.A{refunded, amount}}},
+				"$amount.amount",
+			}}},
+		},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "refunded.amount", Value: amount}}},
+			{Key: "$set", Value: bson.D{
+				{Key: "refunded.currency", Value: payment.Amount.Currency},
+				{Key: "updated_at", Value: updatedAt},
+			}},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("refund on payment %s was not recorded", payment.Payment_id)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("payment %s was refunded by someone else meanwhile", payment.Payment_id)
+	}
+	return nil
+}
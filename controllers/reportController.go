@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"context"
+	"golang-Hotel_Management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// periodFilter reads the optional "from" and "to" query parameters (RFC3339)
+// and turns them into a Mongo range condition. An empty result means no limit.
+func periodFilter(c *gin.Context) (bson.M, error) {
+	period := bson.M{}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, err
+		}
+		period["$gte"] = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, err
+		}
+		period["$lt"] = t
+	}
+	return period, nil
+}
+
+// GetVoidReport returns voided items grouped by the staff member who voided
+// them and by reason, with the quantity and value written off. The optional
+// "from" and "to" query parameters (RFC3339) limit the period.
+func GetVoidReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Components of a voided bundle are counted with the bundle
+		match := bson.M{"voided": true, "bundle_item_id": nil}
+		voidedAt, err := periodFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(voidedAt) > 0 {
+			match["voided_at"] = voidedAt
+		}
+
+		matchStage := bson.D{{Key: "$match", Value: match}}
+		groupByReasonStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "voided_by", Value: "$voided_by"},
+				{Key: "void_reason", Value: "$void_reason"},
+			}},
+			{Key: "item_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$quantity"}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$multiply", Value: bson.A{"$unit_price.amount", "$quantity"}}}}}},
+			{Key: "currency", Value: bson.D{{Key: "$first", Value: "$unit_price.currency"}}},
+		}}}
+		groupByStaffStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$_id.voided_by"},
+			{Key: "item_count", Value: bson.D{{Key: "$sum", Value: "$item_count"}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "currency", Value: bson.D{{Key: "$first", Value: "$currency"}}},
+			{Key: "reasons", Value: bson.D{{Key: "$push", Value: bson.D{
+				{Key: "void_reason", Value: "$_id.void_reason"},
+				{Key: "item_count", Value: "$item_count"},
+				{Key: "quantity", Value: "$quantity"},
+				{Key: "amount", Value: bson.D{
+					{Key: "amount", Value: "$amount"},
+					{Key: "currency", Value: "$currency"},
+				}},
+			}}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "voided_by", Value: "$_id"},
+			{Key: "item_count", Value: 1},
+			{Key: "amount", Value: bson.D{
+				{Key: "amount", Value: "$amount"},
+				{Key: "currency", Value: "$currency"},
+			}},
+			{Key: "reasons", Value: 1},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "amount.amount", Value: -1}}}}
+
+		result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, groupByReasonStage, groupByStaffStage, projectStage, sortStage,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while building the void report"})
+			return
+		}
+
+		var report []bson.M
+		if err = result.All(ctx, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the void report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetCoursePacingReport returns, per course number, the average minutes from
+// the order being opened to the course being fired and from firing to serving.
+func GetCoursePacingReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		match := bson.M{"course_timings": bson.M{"$exists": true}}
+		createdAt, err := periodFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(createdAt) > 0 {
+			match["created_at"] = createdAt
+		}
+
+		minutesBetween := func(from, to string) bson.D {
+			return bson.D{{Key: "$divide", Value: bson.A{
+				bson.D{{Key: "$subtract", Value: bson.A{to, from}}},
+				60000,
+			}}}
+		}
+
+		matchStage := bson.D{{Key: "$match", Value: match}}
+		unwindStage := bson.D{{Key: "$unwind", Value: "$course_timings"}}
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$course_timings.course"},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "avg_minutes_to_fire", Value: bson.D{{Key: "$avg", Value: minutesBetween("$created_at", "$course_timings.fired_at")}}},
+			{Key: "avg_minutes_to_serve", Value: bson.D{{Key: "$avg", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$course_timings.served_at", false}}},
+				minutesBetween("$course_timings.fired_at", "$course_timings.served_at"),
+				nil,
+			}}}}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "course", Value: "$_id"},
+			{Key: "orders", Value: 1},
+			{Key: "avg_minutes_to_fire", Value: 1},
+			{Key: "avg_minutes_to_serve", Value: 1},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "course", Value: 1}}}}
+
+		result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{
+			matchStage, unwindStage, groupStage, projectStage, sortStage,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while building the course pacing report"})
+			return
+		}
+
+		var report []bson.M
+		if err = result.All(ctx, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the course pacing report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetTaxSummaryReport totals the tax charged per category and rate over the
+// invoices issued in the period, for filing tax returns. Tax given back by
+// credit notes issued in the period is subtracted, so the totals are net of
+// refunds.
+func GetTaxSummaryReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		match, err := salesMatch(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// sign is 1 for invoices and -1 for credit notes
+		taxLines := func(sign int) mongo.Pipeline {
+			return mongo.Pipeline{
+				{{Key: "$match", Value: match}},
+				{{Key: "$unwind", Value: "$taxes"}},
+				{{Key: "$project", Value: bson.D{
+					{Key: "category", Value: "$taxes.category"},
+					{Key: "name", Value: "$taxes.name"},
+					{Key: "rate", Value: "$taxes.rate"},
+					{Key: "taxable", Value: bson.D{{Key: "$multiply", Value: bson.A{"$taxes.taxable.amount", sign}}}},
+					{Key: "tax", Value: bson.D{{Key: "$multiply", Value: bson.A{"$taxes.amount.amount", sign}}}},
+					{Key: "currency", Value: "$taxes.amount.currency"},
+					{Key: "invoice", Value: (sign + 1) / 2},
+					{Key: "credit_note", Value: (1 - sign) / 2},
+				}}},
+			}
+		}
+
+		pipeline := append(taxLines(1), bson.D{{Key: "$unionWith", Value: bson.D{
+			{Key: "coll", Value: "creditNote"},
+			{Key: "pipeline", Value: taxLines(-1)},
+		}}})
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "category", Value: "$category"},
+				{Key: "name", Value: "$name"},
+				{Key: "rate", Value: "$rate"},
+			}},
+			{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: "$invoice"}}},
+			{Key: "credit_note_count", Value: bson.D{{Key: "$sum", Value: "$credit_note"}}},
+			{Key: "taxable", Value: bson.D{{Key: "$sum", Value: "$taxable"}}},
+			{Key: "tax", Value: bson.D{{Key: "$sum", Value: "$tax"}}},
+			{Key: "currency", Value: bson.D{{Key: "$first", Value: "$currency"}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "category", Value: "$_id.category"},
+			{Key: "name", Value: "$_id.name"},
+			{Key: "rate", Value: "$_id.rate"},
+			{Key: "invoice_count", Value: 1},
+			{Key: "credit_note_count", Value: 1},
+			{Key: "taxable", Value: bson.D{
+				{Key: "amount", Value: "$taxable"},
+				{Key: "currency", Value: "$currency"},
+			}},
+			{Key: "tax", Value: bson.D{
+				{Key: "amount", Value: "$tax"},
+				{Key: "currency", Value: "$currency"},
+			}},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "category", Value: 1}, {Key: "rate", Value: 1}}}}
+		pipeline = append(pipeline, groupStage, projectStage, sortStage)
+
+		result, err := invoiceCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while building the tax summary"})
+			return
+		}
+
+		var report []bson.M
+		if err = result.All(ctx, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the tax summary"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetSalesReport totals gross sales from the invoices issued in the period,
+// the refunds from the credit notes issued in it and the net sales left, per
+// restaurant and currency.
+func GetSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		match, err := salesMatch(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		invoiceTotals := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "restaurant_id", Value: 1},
+			{Key: "currency", Value: "$grand_total.currency"},
+			{Key: "gross", Value: "$grand_total.amount"},
+			{Key: "refunds", Value: 0},
+			{Key: "invoice", Value: 1},
+			{Key: "credit_note", Value: 0},
+		}}}
+		creditNoteTotals := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "restaurant_id", Value: 1},
+			{Key: "currency", Value: "$amount.currency"},
+			{Key: "gross", Value: 0},
+			{Key: "refunds", Value: "$amount.amount"},
+			{Key: "invoice", Value: 0},
+			{Key: "credit_note", Value: 1},
+		}}}
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "restaurant_id", Value: "$restaurant_id"},
+				{Key: "currency", Value: "$currency"},
+			}},
+			{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: "$invoice"}}},
+			{Key: "credit_note_count", Value: bson.D{{Key: "$sum", Value: "$credit_note"}}},
+			{Key: "gross", Value: bson.D{{Key: "$sum", Value: "$gross"}}},
+			{Key: "refunds", Value: bson.D{{Key: "$sum", Value: "$refunds"}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "restaurant_id", Value: "$_id.restaurant_id"},
+			{Key: "invoice_count", Value: 1},
+			{Key: "credit_note_count", Value: 1},
+			{Key: "gross_sales", Value: bson.D{
+				{Key: "amount", Value: "$gross"},
+				{Key: "currency", Value: "$_id.currency"},
+			}},
+			{Key: "refunds", Value: bson.D{
+				{Key: "amount", Value: "$refunds"},
+				{Key: "currency", Value: "$_id.currency"},
+			}},
+			{Key: "net_sales", Value: bson.D{
+				{Key: "amount", Value: bson.D{{Key: "$subtract", Value: bson.A{"$gross", "$refunds"}}}},
+				{Key: "currency", Value: "$_id.currency"},
+			}},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "restaurant_id", Value: 1}}}}
+
+		result, err := invoiceCollection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: match}},
+			invoiceTotals,
+			{{Key: "$unionWith", Value: bson.D{
+				{Key: "coll", Value: "creditNote"},
+				{Key: "pipeline", Value: mongo.Pipeline{{{Key: "$match", Value: match}}, creditNoteTotals}},
+			}}},
+			groupStage, projectStage, sortStage,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while building the sales report"})
+			return
+		}
+
+		var report []bson.M
+		if err = result.All(ctx, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the sales report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// salesMatch filters invoices and credit notes by the "from", "to" and
+// "restaurant_id" query parameters. Voided invoices are left out.
+func salesMatch(c *gin.Context) (bson.M, error) {
+	match := bson.M{"voided": bson.M{"$ne": true}}
+	createdAt, err := periodFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(createdAt) > 0 {
+		match["created_at"] = createdAt
+	}
+	if restaurantId := c.Query("restaurant_id"); restaurantId != "" {
+		match["restaurant_id"] = restaurantId
+	}
+	return match, nil
+}
+
+// GetTipReport shares out the tips taken between "from" and "to" (RFC3339,
+// both required), usually the start and end of a shift, according to the tip
+// rules in force when each tip was taken and the hours staff worked in that
+// period. Tips on refunded payments are shown apart.
+func GetTipReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, fromErr := time.Parse(time.RFC3339, c.Query("from"))
+		to, toErr := time.Parse(time.RFC3339, c.Query("to"))
+		if fromErr != nil || toErr != nil || !to.After(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required as RFC3339 times, with to after from"})
+			return
+		}
+
+		result, err := paymentCollection.Find(ctx, bson.M{
+			"created_at": bson.M{"$gte": from, "$lt": to},
+			"tip.amount": bson.M{"$gt": 0},
+			"status":     bson.M{"$in": bson.A{"CAPTURED", "REFUNDED", "", nil}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading tips"})
+			return
+		}
+		var tips []models.Payment
+		if err = result.All(ctx, &tips); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding tips"})
+			return
+		}
+
+		result, err = shiftCollection.Find(ctx, bson.M{
+			"clock_in": bson.M{"$lt": to},
+			"$or":      bson.A{bson.M{"clock_out": nil}, bson.M{"clock_out": bson.M{"$gt": from}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading shifts"})
+			return
+		}
+		var shifts []models.Shift
+		if err = result.All(ctx, &shifts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding shifts"})
+			return
+		}
+
+		rules, err := activeTipRules(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while reading tip rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, distributeTips(tips, shifts, rules, from, to))
+	}
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var restaurantCollection *mongo.Collection = database.OpenCollection(database.Client, "restaurant")
+
+func GetRestaurants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := restaurantCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing restaurants"})
+			return
+		}
+
+		var allRestaurants []bson.M
+		if err = result.All(ctx, &allRestaurants); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding restaurants"})
+			return
+		}
+
+		c.JSON(http.StatusOK, allRestaurants)
+	}
+}
+
+func GetRestaurant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		restaurantId := c.Param("restaurant_id")
+		var restaurant models.Restaurant
+
+		err := restaurantCollection.FindOne(ctx, bson.M{"restaurant_id": restaurantId}).Decode(&restaurant)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the restaurant"})
+			return
+		}
+
+		c.JSON(http.StatusOK, restaurant)
+	}
+}
+
+func CreateRestaurant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var restaurant models.Restaurant
+
+		if err := c.BindJSON(&restaurant); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(restaurant)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		for _, format := range []*string{restaurant.Invoice_number_format, restaurant.Credit_note_number_format} {
+			if format == nil {
+				continue
+			}
+			if err := checkNumberFormat(*format); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		restaurant.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		restaurant.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		restaurant.ID = primitive.NewObjectID()
+		restaurant.Restaurant_id = restaurant.ID.Hex()
+
+		if restaurant.Is_default != nil && *restaurant.Is_default {
+			if err := clearDefaultRestaurant(ctx); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while updating the default restaurant"})
+				return
+			}
+		}
+
+		result, insertErr := restaurantCollection.InsertOne(ctx, restaurant)
+		if insertErr != nil {
+			msg := fmt.Sprintf("Restaurant was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateRestaurant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var restaurant models.Restaurant
+
+		restaurantId := c.Param("restaurant_id")
+		filter := bson.M{"restaurant_id": restaurantId}
+
+		if err := c.BindJSON(&restaurant); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if restaurant.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: restaurant.Name})
+		}
+		if restaurant.Address != nil {
+			updateObj = append(updateObj, bson.E{Key: "address", Value: restaurant.Address})
+		}
+		if restaurant.Phone != nil {
+			updateObj = append(updateObj, bson.E{Key: "phone", Value: restaurant.Phone})
+		}
+		if restaurant.Tax_number != nil {
+			updateObj = append(updateObj, bson.E{Key: "tax_number", Value: restaurant.Tax_number})
+		}
+		if restaurant.Prices_include_tax != nil {
+			updateObj = append(updateObj, bson.E{Key: "prices_include_tax", Value: restaurant.Prices_include_tax})
+		}
+		if restaurant.Service_charge_rate != nil {
+			if err := validate.Var(*restaurant.Service_charge_rate, "gte=0,lte=1"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "service_charge_rate", Value: restaurant.Service_charge_rate})
+		}
+		if restaurant.Receipt_template != nil {
+			if err := validate.Struct(restaurant.Receipt_template); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "receipt_template", Value: restaurant.Receipt_template})
+		}
+		if restaurant.Invoice_number_format != nil {
+			if err := checkNumberFormat(*restaurant.Invoice_number_format); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "invoice_number_format", Value: restaurant.Invoice_number_format})
+		}
+		if restaurant.Credit_note_number_format != nil {
+			if err := checkNumberFormat(*restaurant.Credit_note_number_format); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "credit_note_number_format", Value: restaurant.Credit_note_number_format})
+		}
+		if restaurant.Fiscal_year_start_month != nil {
+			if err := validate.Var(*restaurant.Fiscal_year_start_month, "min=1,max=12"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "fiscal_year_start_month", Value: restaurant.Fiscal_year_start_month})
+		}
+		if restaurant.Is_default != nil {
+			if *restaurant.Is_default {
+				if err := clearDefaultRestaurant(ctx); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while updating the default restaurant"})
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{Key: "is_default", Value: restaurant.Is_default})
+		}
+
+		restaurant.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: restaurant.Updated_at})
+
+		result, err := restaurantCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+		if err != nil {
+			msg := "Restaurant update failed"
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// clearDefaultRestaurant unsets the current default so that only one remains.
+func clearDefaultRestaurant(ctx context.Context) error {
+	_, err := restaurantCollection.UpdateMany(ctx, bson.M{"is_default": true}, bson.D{{Key: "$set", Value: bson.D{{Key: "is_default", Value: false}}}})
+	return err
+}
+
+// restaurantForOrder returns the restaurant an order belongs to, falling back to
+// the default restaurant. When none is configured yet, tax-exclusive pricing
+// and the SERVICE_CHARGE_RATE from the environment are used.
+func restaurantForOrder(ctx context.Context, restaurantId *string) (models.Restaurant, error) {
+	var restaurant models.Restaurant
+
+	filter := bson.M{"is_default": true}
+	if restaurantId != nil {
+		filter = bson.M{"restaurant_id": *restaurantId}
+	}
+
+	err := restaurantCollection.FindOne(ctx, filter).Decode(&restaurant)
+	if err == mongo.ErrNoDocuments && restaurantId == nil {
+		err = nil
+	}
+	if err != nil {
+		return restaurant, err
+	}
+
+	if restaurant.Prices_include_tax == nil {
+		inclusive := false
+		restaurant.Prices_include_tax = &inclusive
+	}
+	if restaurant.Service_charge_rate == nil {
+		rate := envFloat("SERVICE_CHARGE_RATE", 0)
+		restaurant.Service_charge_rate = &rate
+	}
+	return restaurant, nil
+}
@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureSearchIndexes creates the text index food search runs on, weighting
+// names above descriptions, and the index popularity is counted with. It is
+// called once at startup: text search fails without its index.
+func EnsureSearchIndexes(ctx context.Context) error {
+	_, err := foodCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().
+			SetName("food_text").
+			SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "description", Value: 3}}),
+	})
+	if err != nil {
+		return fmt.Errorf("food text index: %w", err)
+	}
+	_, err = orderItemCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "food_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("order item popularity index: %w", err)
+	}
+	return nil
+}
+
+// CatalogueQuery holds the search, filter and sort parameters GetFoods and
+// GetMenus share:
+//
+//	q                  text search over food names and descriptions
+//	menu_id            foods of one menu
+//	category           foods of menus in a category, e.g. "Desserts"
+//	min_price          regular price at least this, e.g. "5.50"
+//	max_price          regular price at most this
+//	available          "true" for foods that can be ordered, "false" for the 86 list
+//	dietary            foods carrying every tag given, e.g. "VEGAN,HALAL"
+//	exclude_allergens  foods declared free of all of these, e.g. "MILK,PEANUTS"
+//	sort               "name", "price" or "popularity"; by relevance when searching
+//	order              "asc" or "desc"; popularity defaults to "desc"
+type CatalogueQuery struct {
+	Text              string
+	Menu_id           string
+	Category          string
+	Min_price         *models.Money
+	Max_price         *models.Money
+	Available         *bool
+	Dietary           []string
+	Exclude_allergens []string
+	Sort              string
+	Descending        bool
+}
+
+// parseCatalogueQuery reads and checks the catalogue parameters of a request.
+func parseCatalogueQuery(c *gin.Context) (CatalogueQuery, error) {
+	query := CatalogueQuery{
+		Text:     strings.TrimSpace(c.Query("q")),
+		Menu_id:  c.Query("menu_id"),
+		Category: strings.TrimSpace(c.Query("category")),
+		Sort:     c.Query("sort"),
+	}
+
+	for name, target := range map[string]**models.Money{"min_price": &query.Min_price, "max_price": &query.Max_price} {
+		if value := c.Query(name); value != "" {
+			price, err := models.ParseMoney(value, models.DefaultCurrency)
+			if err != nil {
+				return query, fmt.Errorf("%s: %w", name, err)
+			}
+			*target = &price
+		}
+	}
+	if query.Min_price != nil && query.Max_price != nil && query.Min_price.Amount > query.Max_price.Amount {
+		return query, errors.New("min_price cannot be more than max_price")
+	}
+
+	if value := c.Query("available"); value != "" {
+		available, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, errors.New("available must be true or false")
+		}
+		query.Available = &available
+	}
+
+	if value := c.Query("dietary"); value != "" {
+		query.Dietary = strings.Split(strings.ToUpper(value), ",")
+		if err := validate.Var(query.Dietary, "dive,eq=VEGAN|eq=VEGETARIAN|eq=HALAL|eq=GLUTEN_FREE"); err != nil {
+			return query, err
+		}
+	}
+
+	if value := c.Query("exclude_allergens"); value != "" {
+		query.Exclude_allergens = strings.Split(strings.ToUpper(value), ",")
+		for _, allergen := range query.Exclude_allergens {
+			if !models.IsAllergen(allergen) {
+				return query, fmt.Errorf("unknown allergen %s", allergen)
+			}
+		}
+	}
+
+	switch query.Sort {
+	case "", "name", "price":
+	case "popularity":
+		query.Descending = true
+	default:
+		return query, errors.New("sort must be name, price or popularity")
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	return query, nil
+}
+
+// filtersFoods reports whether the query narrows down the foods listed.
+func (q CatalogueQuery) filtersFoods() bool {
+	return q.Text != "" || q.Min_price != nil || q.Max_price != nil || q.Available != nil ||
+		len(q.Dietary) > 0 || len(q.Exclude_allergens) > 0
+}
+
+// foodConditions turns the food filters of the query into a match document.
+// Text search is left to the caller, since $text has to open a pipeline.
+// Archived foods are never listed.
+func foodConditions(ctx context.Context, q CatalogueQuery) (bson.D, error) {
+	conditions := bson.D{{Key: "archived", Value: bson.D{{Key: "$ne", Value: true}}}}
+
+	if q.Category != "" {
+		menuIds, err := menuIdsInCategory(ctx, q.Category)
+		if err != nil {
+			return nil, err
+		}
+		if q.Menu_id != "" {
+			// The menu asked for still has to be in the category
+			if !containsString(menuIds, q.Menu_id) {
+				menuIds = []string{}
+			} else {
+				menuIds = []string{q.Menu_id}
+			}
+		}
+		conditions = append(conditions, bson.E{Key: "menu_id", Value: bson.D{{Key: "$in", Value: menuIds}}})
+	} else if q.Menu_id != "" {
+		conditions = append(conditions, bson.E{Key: "menu_id", Value: q.Menu_id})
+	}
+
+	price := bson.D{}
+	if q.Min_price != nil {
+		price = append(price, bson.E{Key: "$gte", Value: q.Min_price.Amount})
+	}
+	if q.Max_price != nil {
+		price = append(price, bson.E{Key: "$lte", Value: q.Max_price.Amount})
+	}
+	if len(price) > 0 {
+		conditions = append(conditions, bson.E{Key: "price.amount", Value: price})
+	}
+
+	if q.Available != nil {
+		if *q.Available {
+			conditions = append(conditions, bson.E{Key: "sold_out", Value: bson.D{{Key: "$ne", Value: true}}})
+		} else {
+			conditions = append(conditions, bson.E{Key: "sold_out", Value: true})
+		}
+	}
+
+	if len(q.Dietary) > 0 {
+		conditions = append(conditions, bson.E{Key: "dietary_tags", Value: bson.D{{Key: "$all", Value: q.Dietary}}})
+	}
+
+	// Foods whose allergens were never declared cannot be promised safe
+	if len(q.Exclude_allergens) > 0 {
+		conditions = append(conditions, bson.E{Key: "allergens", Value: bson.D{
+			{Key: "$type", Value: "array"},
+			{Key: "$nin", Value: q.Exclude_allergens},
+		}})
+	}
+
+	return conditions, nil
+}
+
+// menuIdsInCategory returns the ids of the menus in a category, ignoring case.
+func menuIdsInCategory(ctx context.Context, category string) ([]string, error) {
+	pattern := "^" + regexp.QuoteMeta(category) + "$"
+	result, err := menuCollection.Find(ctx, bson.M{"category": bson.M{"$regex": pattern, "$options": "i"}})
+	if err != nil {
+		return nil, errors.New("error occurred while listing the menus")
+	}
+	var menus []models.Menu
+	if err = result.All(ctx, &menus); err != nil {
+		return nil, errors.New("error occurred while decoding the menus")
+	}
+	menuIds := []string{}
+	for _, menu := range menus {
+		menuIds = append(menuIds, menu.Menu_id)
+	}
+	return menuIds, nil
+}
+
+// popularityStages add "popularity" to each food: the quantity ordered, not
+// counting voids, over the last POPULARITY_DAYS days (30 by default).
+func popularityStages() []bson.D {
+	since := time.Now().AddDate(0, 0, -int(envFloat("POPULARITY_DAYS", 30)))
+	return []bson.D{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "orderItem"},
+			{Key: "let", Value: bson.D{{Key: "food_id", Value: "$food_id"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "created_at", Value: bson.D{{Key: "$gte", Value: since}}},
+					{Key: "voided", Value: bson.D{{Key: "$ne", Value: true}}},
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$food_id", "$$food_id"}}}},
+				}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: nil},
+					{Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$quantity"}}},
+				}}},
+			}},
+			{Key: "as", Value: "ordered"},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "popularity", Value: bson.D{{Key: "$ifNull", Value: bson.A{
+				bson.D{{Key: "$first", Value: "$ordered.quantity"}}, 0,
+			}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{{Key: "ordered", Value: 0}}}},
+	}
+}
+
+// foodPipeline returns the stages that find and order the foods a query
+// asks for. Foods stored before the "86" list existed get a sold_out flag.
+func foodPipeline(ctx context.Context, q CatalogueQuery) (mongo.Pipeline, error) {
+	conditions, err := foodConditions(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if q.Text != "" {
+		conditions = append(bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: q.Text}}}}, conditions...)
+	}
+
+	addFields := bson.D{{Key: "sold_out", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$sold_out", false}}}}}
+	if q.Text != "" {
+		addFields = append(addFields, bson.E{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: conditions}},
+		{{Key: "$addFields", Value: addFields}},
+	}
+	if q.Sort == "popularity" {
+		pipeline = append(pipeline, popularityStages()...)
+	}
+	return append(pipeline, foodSortStage(q)), nil
+}
+
+// foodSortStage orders foods as the query asks, by relevance when searching
+// without a sort, and by name otherwise.
+func foodSortStage(q CatalogueQuery) bson.D {
+	direction := 1
+	if q.Descending {
+		direction = -1
+	}
+
+	var sort bson.D
+	switch {
+	case q.Sort == "price":
+		sort = bson.D{{Key: "price.amount", Value: direction}}
+	case q.Sort == "popularity":
+		sort = bson.D{{Key: "popularity", Value: direction}}
+	case q.Sort == "" && q.Text != "":
+		sort = bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}
+	default:
+		sort = bson.D{{Key: "name", Value: direction}}
+	}
+	// Ties keep a stable order between pages
+	sort = append(sort, bson.E{Key: "food_id", Value: 1})
+	return bson.D{{Key: "$sort", Value: sort}}
+}
+
+// searchFoodIds returns the ids of the foods matching a text search.
+func searchFoodIds(ctx context.Context, text string) ([]string, error) {
+	opts := options.Find().SetProjection(bson.D{{Key: "food_id", Value: 1}})
+	result, err := foodCollection.Find(ctx, bson.D{
+		{Key: "$text", Value: bson.D{{Key: "$search", Value: text}}},
+		{Key: "archived", Value: bson.D{{Key: "$ne", Value: true}}},
+	}, opts)
+	if err != nil {
+		return nil, errors.New("error occurred while searching the food items")
+	}
+	var foods []models.Food
+	if err = result.All(ctx, &foods); err != nil {
+		return nil, errors.New("error occurred while decoding the food items")
+	}
+	foodIds := []string{}
+	for _, food := range foods {
+		foodIds = append(foodIds, food.Food_id)
+	}
+	return foodIds, nil
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var shiftCollection *mongo.Collection = database.OpenCollection(database.Client, "shift")
+
+// GetShifts lists shifts, optionally for one "user_id" and for those
+// overlapping the "from" and "to" period (RFC3339).
+func GetShifts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if userId := c.Query("user_id"); userId != "" {
+			filter["user_id"] = userId
+		}
+		period, err := periodFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if to, ok := period["$lt"]; ok {
+			filter["clock_in"] = bson.M{"$lt": to}
+		}
+		if from, ok := period["$gte"]; ok {
+			filter["$or"] = bson.A{
+				bson.M{"clock_out": nil},
+				bson.M{"clock_out": bson.M{"$gt": from}},
+			}
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "clock_in", Value: 1}})
+		result, err := shiftCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing shifts"})
+			return
+		}
+
+		shifts := []models.Shift{}
+		if err = result.All(ctx, &shifts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding shifts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, shifts)
+	}
+}
+
+// ClockIn starts a shift for a staff member at a station.
+func ClockIn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var shift models.Shift
+
+		if err := c.BindJSON(&shift); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(shift)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		open, err := shiftCollection.CountDocuments(ctx, bson.M{"user_id": *shift.User_id, "clock_out": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking open shifts"})
+			return
+		}
+		if open > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "staff member is already clocked in"})
+			return
+		}
+
+		shift.Clock_in, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		shift.Clock_out = nil
+		shift.Created_at = shift.Clock_in
+		shift.Updated_at = shift.Clock_in
+		shift.ID = primitive.NewObjectID()
+		shift.Shift_id = shift.ID.Hex()
+
+		result, insertErr := shiftCollection.InsertOne(ctx, shift)
+		if insertErr != nil {
+			msg := fmt.Sprintf("shift was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// ClockOut ends a running shift.
+func ClockOut() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		shiftId := c.Param("shift_id")
+
+		clockOut, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := shiftCollection.UpdateOne(
+			ctx,
+			bson.M{"shift_id": shiftId, "clock_out": nil},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "clock_out", Value: clockOut},
+				{Key: "updated_at", Value: clockOut},
+			}}},
+		)
+		if err != nil {
+			msg := fmt.Sprintf("shift update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no running shift was found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
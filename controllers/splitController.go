@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SplitBillRequest describes how an order's bill is split into several invoices.
+//   - ITEMS: Parts lists the order_item_ids that go on each invoice; every
+//     billable item must be on exactly one of them.
+//   - SEATS: one invoice per seat number; items without a seat share their own.
+//   - EVEN: the whole bill is divided into Count equal invoices.
+type SplitBillRequest struct {
+	Split_type     *string                  `json:"split_type" validate:"required,eq=ITEMS|eq=SEATS|eq=EVEN"`
+	Parts          [][]string               `json:"parts"`
+	Count          int                      `json:"count" validate:"omitempty,min=2,max=50"`
+	Payment_method *string                  `json:"payment_method" validate:"omitempty,eq=CARD|eq=CASH"`
+	Discounts      []models.InvoiceDiscount `json:"discounts" validate:"dive"`
+}
+
+// SplitOrderBill issues one invoice per part of a split bill. Each invoice is
+// linked to the order, which is settled once all of them are paid.
+func SplitOrderBill() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var splitRequest SplitBillRequest
+		var order models.Order
+
+		orderId := c.Param("order_id")
+
+		if err := c.BindJSON(&splitRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(splitRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+		if err != nil {
+			msg := fmt.Sprintf("message: Order was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if err := checkOrderNotInvoiced(ctx, order.Order_id); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		lines, err := invoiceLinesForOrder(ctx, order.Order_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while retrieving order items"})
+			return
+		}
+		if len(lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order has no billable items"})
+			return
+		}
+
+		restaurant, rates, err := invoicePricingSetup(ctx, order)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var invoices []models.Invoice
+		switch *splitRequest.Split_type {
+		case "EVEN":
+			if splitRequest.Count < 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "count must be at least 2 for an even split"})
+				return
+			}
+			var whole models.Invoice
+			priceInvoice(&whole, lines, splitRequest.Discounts, order, restaurant, rates)
+			invoices = splitInvoiceEvenly(whole, splitRequest.Count)
+
+		case "ITEMS", "SEATS":
+			// A fixed amount off cannot be shared fairly between unequal parts.
+			for _, discount := range splitRequest.Discounts {
+				if discount.Percentage == nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "only percentage discounts can be used when splitting by items or seats"})
+					return
+				}
+			}
+
+			groups, err := groupSplitLines(*splitRequest.Split_type, lines, splitRequest.Parts)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if len(groups) < 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a split needs at least two parts"})
+				return
+			}
+
+			for i, group := range groups {
+				var part models.Invoice
+				// The delivery fee is only charged once, on the first part.
+				partOrder := order
+				if i > 0 {
+					partOrder.Delivery_fee = models.NewMoney(0)
+				}
+				priceInvoice(&part, group, splitRequest.Discounts, partOrder, restaurant, rates)
+				invoices = append(invoices, part)
+			}
+		}
+
+		for i := range invoices {
+			newInvoice(ctx, &invoices[i], order, splitRequest.Payment_method)
+			invoices[i].Split_type = splitRequest.Split_type
+			invoices[i].Split_part = i + 1
+			invoices[i].Split_count = len(invoices)
+		}
+
+		result, insertErr := issueInvoices(ctx, restaurant, invoices)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("order %s has already been invoiced", order.Order_id)})
+			return
+		}
+		if insertErr != nil {
+			msg := fmt.Sprintf("split invoices were not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// groupSplitLines sorts the billable lines into the parts of an item or seat split.
+func groupSplitLines(splitType string, lines []models.InvoiceLine, parts [][]string) ([][]models.InvoiceLine, error) {
+	if splitType == "SEATS" {
+		bySeat := map[int][]models.InvoiceLine{}
+		var seats []int
+		for _, line := range lines {
+			if _, ok := bySeat[line.Seat]; !ok {
+				seats = append(seats, line.Seat)
+			}
+			bySeat[line.Seat] = append(bySeat[line.Seat], line)
+		}
+		// Seat 0 holds the shared items and comes last.
+		sort.Slice(seats, func(i, j int) bool {
+			if seats[i] == 0 || seats[j] == 0 {
+				return seats[j] == 0 && seats[i] != 0
+			}
+			return seats[i] < seats[j]
+		})
+
+		var groups [][]models.InvoiceLine
+		for _, seat := range seats {
+			groups = append(groups, bySeat[seat])
+		}
+		return groups, nil
+	}
+
+	byId := map[string]models.InvoiceLine{}
+	for _, line := range lines {
+		byId[line.Order_item_id] = line
+	}
+
+	assigned := map[string]bool{}
+	var groups [][]models.InvoiceLine
+	for i, part := range parts {
+		if len(part) == 0 {
+			return nil, fmt.Errorf("part %d has no items", i+1)
+		}
+		var group []models.InvoiceLine
+		for _, orderItemId := range part {
+			line, ok := byId[orderItemId]
+			if !ok {
+				return nil, fmt.Errorf("order item %s is not a billable item of this order", orderItemId)
+			}
+			if assigned[orderItemId] {
+				return nil, fmt.Errorf("order item %s is assigned to more than one part", orderItemId)
+			}
+			assigned[orderItemId] = true
+			group = append(group, line)
+		}
+		groups = append(groups, group)
+	}
+
+	if len(assigned) != len(lines) {
+		return nil, fmt.Errorf("every billable item must be assigned to a part, %d of %d are", len(assigned), len(lines))
+	}
+	return groups, nil
+}
+
+// splitInvoiceEvenly divides a priced invoice into n parts. Every amount is
+// split on its own with the leftover cents going to the first parts, and each
+// part's total is rebuilt from its shares, so the parts add up exactly to the
+// whole bill. Each part lists every line with its share of the line's amount.
+func splitInvoiceEvenly(whole models.Invoice, n int) []models.Invoice {
+	parts := make([]models.Invoice, n)
+
+	serviceCharges := whole.Service_charge.Split(n)
+	deliveryFees := whole.Delivery_fee.Split(n)
+
+	for i := range parts {
+		parts[i] = whole
+		parts[i].Subtotal = models.Money{Currency: whole.Subtotal.Currency}
+		parts[i].Service_charge = serviceCharges[i]
+		parts[i].Delivery_fee = deliveryFees[i]
+		parts[i].Line_items = make([]models.InvoiceLine, len(whole.Line_items))
+		parts[i].Discounts = make([]models.InvoiceDiscount, len(whole.Discounts))
+		parts[i].Taxes = make([]models.TaxLine, len(whole.Taxes))
+	}
+
+	// The leftover cents of each line go to the parts after those that took
+	// the previous line's, so the parts' subtotals come out as even as a
+	// split of the whole subtotal.
+	next := 0
+	for l, line := range whole.Line_items {
+		shares := line.Amount.Split(n)
+		extra := int(line.Amount.Amount % int64(n))
+		for i := range parts {
+			share := shares[(i-next+n)%n]
+			parts[i].Line_items[l] = line
+			parts[i].Line_items[l].Amount = share
+			parts[i].Subtotal = parts[i].Subtotal.Add(share)
+		}
+		next = (next + extra) % n
+	}
+
+	for d, discount := range whole.Discounts {
+		for i, share := range discount.Amount.Split(n) {
+			parts[i].Discounts[d] = discount
+			parts[i].Discounts[d].Amount = share
+		}
+	}
+	for t, tax := range whole.Taxes {
+		taxables := tax.Taxable.Split(n)
+		for i, share := range tax.Amount.Split(n) {
+			parts[i].Taxes[t] = tax
+			parts[i].Taxes[t].Taxable = taxables[i]
+			parts[i].Taxes[t].Amount = share
+		}
+	}
+
+	for i := range parts {
+		total := parts[i].Subtotal
+		for _, discount := range parts[i].Discounts {
+			total = total.Sub(discount.Amount)
+		}
+		total = total.Add(parts[i].Service_charge).Add(parts[i].Delivery_fee)
+		if !whole.Prices_include_tax {
+			for _, tax := range parts[i].Taxes {
+				total = total.Add(tax.Amount)
+			}
+		}
+		parts[i].Grand_total = total
+		parts[i].Payment_due = total
+	}
+	return parts
+}
+
+// settleOrderIfPaid marks the order SETTLED once every invoice issued for it,
+// whole or split, has been paid. Voided invoices are not counted.
+func settleOrderIfPaid(ctx context.Context, orderId string) error {
+	total, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": orderId, "voided": bson.M{"$ne": true}})
+	if err != nil || total == 0 {
+		return err
+	}
+
+	unpaid, err := invoiceCollection.CountDocuments(ctx, bson.M{
+		"order_id":       orderId,
+		"voided":         bson.M{"$ne": true},
+		"payment_status": bson.M{"$nin": bson.A{"PAID", "OVERPAID"}},
+	})
+	if err != nil || unpaid > 0 {
+		return err
+	}
+
+	settledAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err = orderCollection.UpdateOne(ctx, bson.M{"order_id": orderId}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: "SETTLED"},
+		{Key: "updated_at", Value: settledAt},
+	}}})
+	return err
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultTaxCategory is used for foods that have no tax category.
+const DefaultTaxCategory = "STANDARD"
+
+// ServiceTaxCategory is the category the service charge is taxed under.
+const ServiceTaxCategory = "SERVICE"
+
+var taxRateCollection *mongo.Collection = database.OpenCollection(database.Client, "taxRate")
+
+// GetTaxRates lists tax rates, optionally only those in effect at ?at= (RFC3339).
+func GetTaxRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if at := c.Query("at"); at != "" {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter = effectiveAt(t)
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "category", Value: 1}, {Key: "effective_from", Value: -1}})
+		result, err := taxRateCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing tax rates"})
+			return
+		}
+
+		var allTaxRates []bson.M
+		if err = result.All(ctx, &allTaxRates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding tax rates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, allTaxRates)
+	}
+}
+
+// CreateTaxRate adds a rate for a category. An open-ended rate of the same
+// category that started earlier is closed off where the new one begins.
+func CreateTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var taxRate models.TaxRate
+
+		if err := c.BindJSON(&taxRate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(taxRate)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if taxRate.Effective_to != nil && !taxRate.Effective_to.After(*taxRate.Effective_from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "effective_to must be after effective_from"})
+			return
+		}
+
+		_, err := taxRateCollection.UpdateMany(
+			ctx,
+			bson.M{
+				"category":       taxRate.Category,
+				"effective_to":   nil,
+				"effective_from": bson.M{"$lt": taxRate.Effective_from},
+			},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "effective_to", Value: taxRate.Effective_from}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while closing the previous rate"})
+			return
+		}
+
+		taxRate.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		taxRate.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		taxRate.ID = primitive.NewObjectID()
+		taxRate.Tax_rate_id = taxRate.ID.Hex()
+
+		result, insertErr := taxRateCollection.InsertOne(ctx, taxRate)
+		if insertErr != nil {
+			msg := fmt.Sprintf("Tax rate was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// effectiveAt matches the rates in effect at the given time.
+func effectiveAt(at time.Time) bson.M {
+	return bson.M{
+		"effective_from": bson.M{"$lte": at},
+		"$or": bson.A{
+			bson.M{"effective_to": nil},
+			bson.M{"effective_to": bson.M{"$gt": at}},
+		},
+	}
+}
+
+// taxRatesAt returns the rate in effect at the given time for every category.
+// When rates overlap, the one that started last wins.
+func taxRatesAt(ctx context.Context, at time.Time) (map[string]models.TaxRate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: 1}})
+	result, err := taxRateCollection.Find(ctx, effectiveAt(at), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var taxRates []models.TaxRate
+	if err = result.All(ctx, &taxRates); err != nil {
+		return nil, err
+	}
+
+	rates := map[string]models.TaxRate{}
+	for _, taxRate := range taxRates {
+		rates[*taxRate.Category] = taxRate
+	}
+	return rates, nil
+}
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"golang-Hotel_Management/payments"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var tipRuleCollection *mongo.Collection = database.OpenCollection(database.Client, "tipRule")
+
+func GetTipRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := tipRuleCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing tip rules"})
+			return
+		}
+
+		rules := []models.TipRule{}
+		if err = result.All(ctx, &rules); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding tip rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+func CreateTipRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rule models.TipRule
+
+		if err := c.BindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(rule)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if rule.Active == nil {
+			active := true
+			rule.Active = &active
+		}
+		if *rule.Active {
+			if err := checkTipOutTotal(ctx, "", *rule.Percentage); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		rule.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		rule.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		rule.ID = primitive.NewObjectID()
+		rule.Tip_rule_id = rule.ID.Hex()
+
+		result, insertErr := tipRuleCollection.InsertOne(ctx, rule)
+		if insertErr != nil {
+			msg := fmt.Sprintf("Tip rule was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateTipRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rule models.TipRule
+		var existing models.TipRule
+
+		tipRuleId := c.Param("tip_rule_id")
+		filter := bson.M{"tip_rule_id": tipRuleId}
+
+		if err := c.BindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tipRuleCollection.FindOne(ctx, filter).Decode(&existing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tip rule was not found"})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if rule.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: rule.Name})
+		}
+		if rule.Station != nil {
+			if err := validate.Var(*rule.Station, "eq=FLOOR|eq=KITCHEN|eq=BAR"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "station", Value: rule.Station})
+		}
+		if rule.Percentage != nil {
+			if err := validate.Var(*rule.Percentage, "gt=0,lte=1"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			existing.Percentage = rule.Percentage
+			updateObj = append(updateObj, bson.E{Key: "percentage", Value: rule.Percentage})
+		}
+		if rule.Split_by != nil {
+			if err := validate.Var(*rule.Split_by, "eq=HOURS|eq=EQUAL"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "split_by", Value: rule.Split_by})
+		}
+		if rule.Active != nil {
+			existing.Active = rule.Active
+			updateObj = append(updateObj, bson.E{Key: "active", Value: rule.Active})
+		}
+
+		if existing.Active != nil && *existing.Active {
+			if err := checkTipOutTotal(ctx, tipRuleId, *existing.Percentage); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		rule.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: rule.Updated_at})
+
+		result, err := tipRuleCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+		if err != nil {
+			msg := "Tip rule update failed"
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// activeTipRules returns the tip rules currently in use.
+func activeTipRules(ctx context.Context) ([]models.TipRule, error) {
+	result, err := tipRuleCollection.Find(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+	rules := []models.TipRule{}
+	err = result.All(ctx, &rules)
+	return rules, err
+}
+
+// tipOuts records the given rules as they stand now.
+func tipOuts(rules []models.TipRule) []models.TipOut {
+	outs := []models.TipOut{}
+	for _, rule := range rules {
+		outs = append(outs, models.TipOut{
+			Tip_rule_id: rule.Tip_rule_id,
+			Name:        *rule.Name,
+			Station:     *rule.Station,
+			Percentage:  *rule.Percentage,
+			Split_by:    *rule.Split_by,
+		})
+	}
+	return outs
+}
+
+// checkTipOutTotal makes sure the active rules, with one of them set to
+// percentage, never take more than the whole tip.
+func checkTipOutTotal(ctx context.Context, tipRuleId string, percentage float64) error {
+	rules, err := activeTipRules(ctx)
+	if err != nil {
+		return errors.New("error occurred while reading tip rules")
+	}
+	total := percentage
+	for _, rule := range rules {
+		if rule.Tip_rule_id != tipRuleId {
+			total += *rule.Percentage
+		}
+	}
+	if total > 1 {
+		return fmt.Errorf("active tip rules would take %.0f%% of each tip", total*100)
+	}
+	return nil
+}
+
+// TipShare is what one staff member ends up with over a period.
+type TipShare struct {
+	User_id     string       `json:"user_id"`
+	Stations    []string     `json:"stations"`
+	Hours       float64      `json:"hours"`       // Hours worked within the period
+	Tips_taken  models.Money `json:"tips_taken"`  // Tips on the payments they took
+	Tipped_out  models.Money `json:"tipped_out"`  // Paid from their tips into the pools
+	Pool_share  models.Money `json:"pool_share"`  // Received from the pools
+	Tips_earned models.Money `json:"tips_earned"` // Tips_taken - Tipped_out + Pool_share
+}
+
+// TipPool is the money one rule collected and how it was shared out.
+type TipPool struct {
+	Tip_rule_id   string       `json:"tip_rule_id"`
+	Name          string       `json:"name"`
+	Station       string       `json:"station"`
+	Split_by      string       `json:"split_by"`
+	Amount        models.Money `json:"amount"`
+	Undistributed models.Money `json:"undistributed"` // Nobody worked at the station in the period
+}
+
+// TipDistribution is the tip report for one period, such as a lunch shift.
+type TipDistribution struct {
+	From          time.Time    `json:"from"`
+	To            time.Time    `json:"to"`
+	Total_tips    models.Money `json:"total_tips"`
+	Refunded_tips models.Money `json:"refunded_tips"` // Tips on payments the provider refunded, shared with nobody
+	Pools         []TipPool    `json:"pools"`
+	Staff         []TipShare   `json:"staff"`
+}
+
+// distributeTips applies the tip rules to the tips taken in a period. Each tip
+// pays the percentage of every rule in force when it was taken into that
+// rule's pool and the rest stays with whoever took the payment; tips taken
+// before payments recorded their rules use the active rules. Each pool is
+// then split among the staff who worked at its station during the period, by
+// minutes worked or equally. Refunded payments are left out.
+func distributeTips(tips []models.Payment, shifts []models.Shift, rules []models.TipRule, from, to time.Time) TipDistribution {
+	zero := models.Money{Currency: models.DefaultCurrency}
+	distribution := TipDistribution{From: from, To: to, Total_tips: zero, Refunded_tips: zero, Pools: []TipPool{}, Staff: []TipShare{}}
+
+	staff := map[string]*TipShare{}
+	share := func(userId string) *TipShare {
+		if staff[userId] == nil {
+			staff[userId] = &TipShare{User_id: userId, Stations: []string{}, Tips_taken: zero, Tipped_out: zero, Pool_share: zero}
+		}
+		return staff[userId]
+	}
+
+	// A rule whose station or split changed over the period fills one pool
+	// per version
+	pools := []TipPool{}
+	poolIndex := map[string]int{}
+	pool := func(out models.TipOut) *TipPool {
+		key := out.Tip_rule_id + "|" + out.Station + "|" + out.Split_by
+		if _, ok := poolIndex[key]; !ok {
+			poolIndex[key] = len(pools)
+			pools = append(pools, TipPool{Tip_rule_id: out.Tip_rule_id, Name: out.Name, Station: out.Station, Split_by: out.Split_by, Amount: zero, Undistributed: zero})
+		}
+		return &pools[poolIndex[key]]
+	}
+	current := tipOuts(rules)
+	for _, out := range current {
+		pool(out)
+	}
+
+	for _, payment := range tips {
+		if payment.Status == payments.StatusRefunded {
+			distribution.Refunded_tips = distribution.Refunded_tips.Add(payment.Tip)
+			continue
+		}
+		taker := share(*payment.Staff_id)
+		taker.Tips_taken = taker.Tips_taken.Add(payment.Tip)
+		distribution.Total_tips = distribution.Total_tips.Add(payment.Tip)
+
+		outs := payment.Tip_outs
+		if outs == nil {
+			outs = current
+		}
+		remaining := payment.Tip
+		for _, tipOut := range outs {
+			out := payment.Tip.MulRate(tipOut.Percentage).Min(remaining)
+			remaining = remaining.Sub(out)
+			tipPool := pool(tipOut)
+			tipPool.Amount = tipPool.Amount.Add(out)
+			taker.Tipped_out = taker.Tipped_out.Add(out)
+		}
+	}
+
+	// Minutes worked per station and staff member, clipped to the period
+	minutes := map[string]map[string]int64{}
+	for _, shift := range shifts {
+		start, end := shift.Clock_in, to
+		if shift.Clock_out != nil && shift.Clock_out.Before(end) {
+			end = *shift.Clock_out
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if !end.After(start) {
+			continue
+		}
+		if minutes[*shift.Station] == nil {
+			minutes[*shift.Station] = map[string]int64{}
+		}
+		worked := int64(end.Sub(start) / time.Minute)
+		minutes[*shift.Station][*shift.User_id] += worked
+
+		worker := share(*shift.User_id)
+		worker.Hours += float64(worked) / 60
+		if !containsString(worker.Stations, *shift.Station) {
+			worker.Stations = append(worker.Stations, *shift.Station)
+		}
+	}
+
+	for i, tipPool := range pools {
+		var userIds []string
+		for userId, worked := range minutes[tipPool.Station] {
+			if worked > 0 {
+				userIds = append(userIds, userId)
+			}
+		}
+		if len(userIds) == 0 {
+			pools[i].Undistributed = pools[i].Amount
+			continue
+		}
+		sort.Strings(userIds)
+
+		weights := make([]int64, len(userIds))
+		for j, userId := range userIds {
+			weights[j] = 1
+			if tipPool.Split_by == "HOURS" {
+				weights[j] = minutes[tipPool.Station][userId]
+			}
+		}
+		for j, part := range pools[i].Amount.Allocate(weights) {
+			worker := share(userIds[j])
+			worker.Pool_share = worker.Pool_share.Add(part)
+		}
+	}
+
+	for _, tipShare := range staff {
+		tipShare.Tips_earned = tipShare.Tips_taken.Sub(tipShare.Tipped_out).Add(tipShare.Pool_share)
+		distribution.Staff = append(distribution.Staff, *tipShare)
+	}
+	sort.Slice(distribution.Staff, func(i, j int) bool {
+		return distribution.Staff[i].User_id < distribution.Staff[j].User_id
+	})
+	distribution.Pools = pools
+	return distribution
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
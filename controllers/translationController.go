@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+)
+
+// defaultLanguage is the language names and descriptions are stored in,
+// from DEFAULT_LANGUAGE ("en" by default).
+func defaultLanguage() string {
+	tag, err := languageTag(envString("DEFAULT_LANGUAGE", "en"))
+	if err != nil {
+		return "en"
+	}
+	return tag
+}
+
+// languageTag returns the canonical form of a language tag, e.g. "de-CH" for
+// "de-ch", leaving out extensions such as "-u-ca-buddhist".
+func languageTag(value string) (string, error) {
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a language tag such as \"fr\" or \"de-CH\"", value)
+	}
+	base, script, region := tag.Raw()
+	tag, err = language.Compose(base, script, region)
+	if err != nil || tag == language.Und {
+		return "", fmt.Errorf("%q is not a language tag such as \"fr\" or \"de-CH\"", value)
+	}
+	return tag.String(), nil
+}
+
+// normalizeTranslations checks the languages of translations and keys them by
+// their canonical tags. The default language has no translation: it is the
+// name and description themselves.
+func normalizeTranslations(translations map[string]models.Translation) (map[string]models.Translation, error) {
+	if translations == nil {
+		return nil, nil
+	}
+	normalized := map[string]models.Translation{}
+	for key, translation := range translations {
+		tag, err := languageTag(key)
+		if err != nil {
+			return nil, err
+		}
+		if tag == defaultLanguage() {
+			return nil, fmt.Errorf("%s is the default language: set the name and description instead", tag)
+		}
+		if _, duplicate := normalized[tag]; duplicate {
+			return nil, fmt.Errorf("%s is translated twice", tag)
+		}
+		if translation.Name == "" && translation.Description == "" {
+			return nil, fmt.Errorf("the %s translation is empty", tag)
+		}
+		normalized[tag] = translation
+	}
+	return normalized, nil
+}
+
+// requestLanguages returns the languages a request asks for, most wanted
+// first: the "lang" parameter, or else the Accept-Language header. Each
+// regional tag is followed by its language, so "de-CH" falls back to "de".
+// The list stops at the default language, which every food and menu has.
+func requestLanguages(c *gin.Context) ([]string, error) {
+	var tags []language.Tag
+	if value := c.Query("lang"); value != "" {
+		tag, err := languageTag(value)
+		if err != nil {
+			return nil, errors.New("lang: " + err.Error())
+		}
+		tags = []language.Tag{language.Make(tag)}
+	} else {
+		// A malformed header is ignored rather than refused
+		tags, _, _ = language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	}
+
+	fallback := defaultLanguage()
+	languages := []string{}
+	for _, tag := range tags {
+		base, script, region := tag.Raw()
+		tag, err := language.Compose(base, script, region)
+		if err != nil || tag == language.Und || base.String() == "mul" {
+			continue
+		}
+		for _, candidate := range []string{tag.String(), base.String()} {
+			if candidate == fallback {
+				return languages, nil
+			}
+			if !containsString(languages, candidate) {
+				languages = append(languages, candidate)
+			}
+		}
+	}
+	return languages, nil
+}
+
+// translate picks the first of languages the translations give field of
+// ("name" or "description") in, returning the text and its language, or
+// value in the default language when none does.
+func translate(translations map[string]models.Translation, languages []string, field, value string) (string, string) {
+	for _, lang := range languages {
+		translation := translations[lang]
+		text := translation.Name
+		if field == "description" {
+			text = translation.Description
+		}
+		if text != "" {
+			return text, lang
+		}
+	}
+	return value, defaultLanguage()
+}
+
+// localizeFood puts the name and description of a food in the first of
+// languages it is translated into.
+func localizeFood(food *models.Food, languages []string) {
+	if food.Name != nil {
+		name, lang := translate(food.Translations, languages, "name", *food.Name)
+		food.Name, food.Language = &name, lang
+	} else {
+		food.Language = defaultLanguage()
+	}
+	var description string
+	if food.Description != nil {
+		description = *food.Description
+	}
+	if description, lang := translate(food.Translations, languages, "description", description); food.Description != nil || lang != defaultLanguage() {
+		food.Description = &description
+	}
+}
+
+// localizeMenu puts the name and description of a menu in the first of
+// languages it is translated into.
+func localizeMenu(menu *models.Menu, languages []string) {
+	menu.Name, menu.Language = translate(menu.Translations, languages, "name", menu.Name)
+	menu.Description, _ = translate(menu.Translations, languages, "description", menu.Description)
+}
+
+// localizeStage is the aggregation counterpart of localizeFood and
+// localizeMenu, for pipelines listing foods or menus.
+func localizeStage(languages []string) bson.D {
+	fields := bson.D{}
+	for _, field := range []string{"name", "description"} {
+		branches := bson.A{}
+		for _, lang := range languages {
+			path := "$translations." + lang + "." + field
+			branches = append(branches, bson.D{
+				{Key: "case", Value: bson.D{{Key: "$gt", Value: bson.A{path, ""}}}},
+				{Key: "then", Value: path},
+			})
+		}
+		if len(branches) == 0 {
+			continue
+		}
+		fields = append(fields, bson.E{Key: field, Value: bson.D{{Key: "$switch", Value: bson.D{
+			{Key: "branches", Value: branches},
+			{Key: "default", Value: "$" + field},
+		}}}})
+	}
+
+	// The language reported is the one the name ended up in
+	languageBranches := bson.A{}
+	for _, lang := range languages {
+		languageBranches = append(languageBranches, bson.D{
+			{Key: "case", Value: bson.D{{Key: "$gt", Value: bson.A{"$translations." + lang + ".name", ""}}}},
+			{Key: "then", Value: lang},
+		})
+	}
+	if len(languageBranches) == 0 {
+		fields = append(fields, bson.E{Key: "language", Value: defaultLanguage()})
+	} else {
+		fields = append(fields, bson.E{Key: "language", Value: bson.D{{Key: "$switch", Value: bson.D{
+			{Key: "branches", Value: languageBranches},
+			{Key: "default", Value: defaultLanguage()},
+		}}}})
+	}
+	return bson.D{{Key: "$addFields", Value: fields}}
+}
+
+// TranslationGap is a food or menu missing some of the languages reported on,
+// with the fields each of them lacks.
+type TranslationGap struct {
+	Food_id string              `json:"food_id,omitempty"`
+	Menu_id string              `json:"menu_id"`
+	Name    string              `json:"name"`
+	Missing map[string][]string `json:"missing"` // e.g. {"de": ["name", "description"], "fr": ["description"]}
+}
+
+// LanguageCompleteness counts how many foods and menus are fully translated
+// into one language.
+type LanguageCompleteness struct {
+	Language       string `json:"language"`
+	Foods_complete int    `json:"foods_complete"`
+	Foods_total    int    `json:"foods_total"`
+	Menus_complete int    `json:"menus_complete"`
+	Menus_total    int    `json:"menus_total"`
+}
+
+// missingTranslations returns, per language, the fields a food or menu has in
+// the default language but not in that one.
+func missingTranslations(translations map[string]models.Translation, languages []string, name, description string) map[string][]string {
+	missing := map[string][]string{}
+	for _, lang := range languages {
+		translation := translations[lang]
+		if name != "" && translation.Name == "" {
+			missing[lang] = append(missing[lang], "name")
+		}
+		if description != "" && translation.Description == "" {
+			missing[lang] = append(missing[lang], "description")
+		}
+	}
+	return missing
+}
+
+// GetTranslationReport lists the foods and menus missing a translation into
+// any of the languages given as "languages" (e.g. "fr,de"), SUPPORTED_LANGUAGES
+// when not given, or else every language something is translated into.
+func GetTranslationReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var foods []models.Food
+		var menus []models.Menu
+
+		projection := options.Find().SetProjection(bson.D{
+			{Key: "food_id", Value: 1}, {Key: "menu_id", Value: 1}, {Key: "name", Value: 1},
+			{Key: "description", Value: 1}, {Key: "translations", Value: 1},
+		})
+		result, err := foodCollection.Find(ctx, bson.M{"archived": bson.M{"$ne": true}}, projection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing the food items"})
+			return
+		}
+		if err = result.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the food items"})
+			return
+		}
+		result, err = menuCollection.Find(ctx, bson.M{}, projection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing the menus"})
+			return
+		}
+		if err = result.All(ctx, &menus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding the menus"})
+			return
+		}
+
+		languages, err := reportLanguages(c.Query("languages"), foods, menus)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		summary := map[string]*LanguageCompleteness{}
+		for _, lang := range languages {
+			summary[lang] = &LanguageCompleteness{Language: lang, Foods_total: len(foods), Menus_total: len(menus)}
+		}
+
+		foodGaps := []TranslationGap{}
+		for _, food := range foods {
+			var name, description, menuId string
+			if food.Name != nil {
+				name = *food.Name
+			}
+			if food.Description != nil {
+				description = *food.Description
+			}
+			if food.Menu_id != nil {
+				menuId = *food.Menu_id
+			}
+			missing := missingTranslations(food.Translations, languages, name, description)
+			for _, lang := range languages {
+				if _, ok := missing[lang]; !ok {
+					summary[lang].Foods_complete++
+				}
+			}
+			if len(missing) > 0 {
+				foodGaps = append(foodGaps, TranslationGap{Food_id: food.Food_id, Menu_id: menuId, Name: name, Missing: missing})
+			}
+		}
+
+		menuGaps := []TranslationGap{}
+		for _, menu := range menus {
+			missing := missingTranslations(menu.Translations, languages, menu.Name, menu.Description)
+			for _, lang := range languages {
+				if _, ok := missing[lang]; !ok {
+					summary[lang].Menus_complete++
+				}
+			}
+			if len(missing) > 0 {
+				menuGaps = append(menuGaps, TranslationGap{Menu_id: menu.Menu_id, Name: menu.Name, Missing: missing})
+			}
+		}
+
+		completeness := []LanguageCompleteness{}
+		for _, lang := range languages {
+			completeness = append(completeness, *summary[lang])
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"default_language": defaultLanguage(),
+			"languages":        completeness,
+			"foods":            foodGaps,
+			"menus":            menuGaps,
+		})
+	}
+}
+
+// reportLanguages returns the languages the translation report covers.
+func reportLanguages(value string, foods []models.Food, menus []models.Menu) ([]string, error) {
+	if value == "" {
+		value = envString("SUPPORTED_LANGUAGES", "")
+	}
+
+	languages := []string{}
+	if value != "" {
+		for _, part := range strings.Split(value, ",") {
+			tag, err := languageTag(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			if tag != defaultLanguage() && !containsString(languages, tag) {
+				languages = append(languages, tag)
+			}
+		}
+		return languages, nil
+	}
+
+	for _, food := range foods {
+		for lang := range food.Translations {
+			if !containsString(languages, lang) {
+				languages = append(languages, lang)
+			}
+		}
+	}
+	for _, menu := range menus {
+		for lang := range menu.Translations {
+			if !containsString(languages, lang) {
+				languages = append(languages, lang)
+			}
+		}
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
@@ -0,0 +1,428 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Reason codes accepted when voiding an order item or a whole order.
+const (
+	VoidReasonGuestChangedMind = "GUEST_CHANGED_MIND"
+	VoidReasonKitchenError     = "KITCHEN_ERROR"
+	VoidReasonComp             = "COMP"
+	VoidReasonWalkout          = "WALKOUT"
+)
+
+// VoidRequest is the body of a void call. Manager_id and Manager_pin are only
+// needed once the affected items have already been sent to the kitchen.
+type VoidRequest struct {
+	Reason_code *string `json:"reason_code" validate:"required,eq=GUEST_CHANGED_MIND|eq=KITCHEN_ERROR|eq=COMP|eq=WALKOUT"`
+	Staff_id    *string `json:"staff_id" validate:"required"`
+	Manager_id  *string `json:"manager_id"`
+	Manager_pin *string `json:"manager_pin"`
+}
+
+var errManagerApprovalRequired = errors.New("manager approval is required to void items already sent to the kitchen")
+
+// verifyManagerApproval checks that the manager exists, holds the MANAGER or
+// ADMIN role and that the PIN matches the stored hash.
+func verifyManagerApproval(ctx context.Context, managerId, pin *string) error {
+	if managerId == nil || pin == nil {
+		return errManagerApprovalRequired
+	}
+
+	var manager models.User
+	err := userCollection.FindOne(ctx, bson.M{
+		"user_id": *managerId,
+		"role":    bson.M{"$in": bson.A{"MANAGER", "ADMIN"}},
+	}).Decode(&manager)
+	if err != nil || manager.Pin == nil {
+		return errors.New("manager was not found")
+	}
+
+	if err := checkPin(ctx, manager, *pin); err == errPinLocked {
+		return err
+	} else if err != nil {
+		return errors.New("manager PIN is incorrect")
+	}
+	return nil
+}
+
+var errPinLocked = errors.New("too many wrong PINs; try again later")
+
+// checkPin compares a PIN with the user's. After PIN_MAX_FAILURES wrong PINs
+// in a row (5 by default) checks are refused for PIN_LOCK_MINUTES (15), so
+// that a PIN cannot be guessed by trying them all.
+func checkPin(ctx context.Context, user models.User, pin string) error {
+	now := time.Now()
+	if user.Pin_locked_until != nil && now.Before(*user.Pin_locked_until) {
+		return errPinLocked
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(*user.Pin), []byte(pin)) == nil {
+		if user.Pin_failures > 0 || user.Pin_locked_until != nil {
+			userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, bson.D{
+				{Key: "$set", Value: bson.D{{Key: "pin_failures", Value: 0}, {Key: "pin_locked_until", Value: nil}}},
+			})
+		}
+		return nil
+	}
+
+	var failed models.User
+	err := userCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": user.User_id},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "pin_failures", Value: 1}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&failed)
+	if err == nil && failed.Pin_failures >= int(envFloat("PIN_MAX_FAILURES", 5)) {
+		lockedUntil := now.Add(time.Duration(envFloat("PIN_LOCK_MINUTES", 15)) * time.Minute)
+		userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, bson.D{
+			{Key: "$set", Value: bson.D{{Key: "pin_failures", Value: 0}, {Key: "pin_locked_until", Value: lockedUntil}}},
+		})
+		log.Println("approval PIN of user", user.User_id, "locked after too many wrong PINs")
+	}
+	return errors.New("PIN is incorrect")
+}
+
+// checkManagerCaller makes sure the signed-in user, whose id the
+// authentication middleware sets as "uid", is a manager or admin.
+func checkManagerCaller(ctx context.Context, c *gin.Context) error {
+	uid := c.GetString("uid")
+	if uid == "" {
+		return errors.New("sign in as a manager or admin")
+	}
+	count, err := userCollection.CountDocuments(ctx, bson.M{
+		"user_id": uid,
+		"role":    bson.M{"$in": bson.A{"MANAGER", "ADMIN"}},
+	})
+	if err != nil || count == 0 {
+		return errors.New("only managers and admins can set an approval PIN")
+	}
+	return nil
+}
+
+// PinRequest is the body of a PIN change. Current_pin is needed when the user
+// already has a PIN; otherwise another manager approves the first one.
+type PinRequest struct {
+	Pin         *string `json:"pin" validate:"required,numeric,min=4,max=8"`
+	Current_pin *string `json:"current_pin"`
+	Manager_id  *string `json:"manager_id"`
+	Manager_pin *string `json:"manager_pin"`
+}
+
+// SetUserPin sets the approval PIN of a manager or admin, stored as a bcrypt
+// hash. Only a signed-in manager or admin may call it. The very first PIN of
+// the restaurant needs no approval, as no manager could give it yet.
+func SetUserPin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var pinRequest PinRequest
+		var user models.User
+
+		userId := c.Param("user_id")
+
+		if err := c.BindJSON(&pinRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(pinRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if err := checkManagerCaller(ctx, c); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user was not found"})
+			return
+		}
+		if user.Role == nil || (*user.Role != "MANAGER" && *user.Role != "ADMIN") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only managers and admins have an approval PIN"})
+			return
+		}
+
+		if user.Pin != nil {
+			if pinRequest.Current_pin == nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "current PIN is incorrect"})
+				return
+			}
+			if err := checkPin(ctx, user, *pinRequest.Current_pin); err == errPinLocked {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "current PIN is incorrect"})
+				return
+			}
+		} else {
+			managers, err := userCollection.CountDocuments(ctx, bson.M{
+				"role": bson.M{"$in": bson.A{"MANAGER", "ADMIN"}},
+				"pin":  bson.M{"$ne": nil},
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking the managers"})
+				return
+			}
+			if managers > 0 {
+				if pinRequest.Manager_id != nil && *pinRequest.Manager_id == userId {
+					c.JSON(http.StatusForbidden, gin.H{"error": "another manager must approve the first PIN"})
+					return
+				}
+				if err := verifyManagerApproval(ctx, pinRequest.Manager_id, pinRequest.Manager_pin); err != nil {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+					return
+				}
+			}
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(*pinRequest.Pin), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while hashing the PIN"})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": userId},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "pin", Value: string(hash)},
+				{Key: "updated_at", Value: updatedAt},
+			}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "PIN update failed"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// VoidOrderItem voids a single order item with a reason code. Voided items stay
+// in the collection for reporting but are left out of invoices.
+func VoidOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var voidRequest VoidRequest
+		var orderItem models.OrderItem
+
+		orderItemId := c.Param("orderItem_id")
+
+		if err := c.BindJSON(&voidRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(voidRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+
+		if orderItem.Voided {
+			c.JSON(http.StatusConflict, gin.H{"error": "order item is already voided"})
+			return
+		}
+		if orderItem.Bundle_item_id != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "components are voided with their bundle"})
+			return
+		}
+
+		// Voiding the last items goes through voiding the order
+		if err := checkOrderMinimum(ctx, orderItem.Order_id, orderItem.Order_item_id, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error() + ": void the whole order instead"})
+			return
+		}
+
+		var approvedBy *string
+		if orderItem.Sent_at != nil {
+			if err := verifyManagerApproval(ctx, voidRequest.Manager_id, voidRequest.Manager_pin); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			approvedBy = voidRequest.Manager_id
+		}
+
+		// The item must still be in the state the approval was decided on: one
+		// sent to the kitchen in the meantime needs a manager.
+		filter := bson.M{"order_item_id": orderItemId, "voided": bson.M{"$ne": true}}
+		if orderItem.Sent_at != nil {
+			filter["sent_at"] = bson.M{"$ne": nil}
+		} else {
+			filter["sent_at"] = nil
+		}
+
+		voidedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := voidUpdate(voidRequest, approvedBy, voidedAt)
+		result, err := orderItemCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+		if err != nil {
+			msg := fmt.Sprintf("order item void failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "order item was voided or sent to the kitchen meanwhile, please try again"})
+			return
+		}
+		if result.ModifiedCount == 1 {
+			releaseVoidedItem(ctx, orderItem)
+			if orderItem.Bundle {
+				voidBundleComponents(ctx, orderItem.Order_item_id, updateObj)
+			}
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// VoidOrder voids a whole order and every item on it that is not already voided.
+func VoidOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var voidRequest VoidRequest
+		var order models.Order
+
+		orderId := c.Param("order_id")
+
+		if err := c.BindJSON(&voidRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(voidRequest)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order was not found"})
+			return
+		}
+
+		if order.Status == "VOIDED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "order is already voided"})
+			return
+		}
+
+		itemFilter := bson.M{"order_id": orderId, "voided": bson.M{"$ne": true}}
+
+		// The items about to be voided are the ones whose stock goes back.
+		cursor, err := orderItemCollection.Find(ctx, itemFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing order items"})
+			return
+		}
+		var orderItems []models.OrderItem
+		if err = cursor.All(ctx, &orderItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while decoding order items"})
+			return
+		}
+
+		// One item already in the kitchen is enough to need a manager.
+		var approvedBy *string
+		for _, orderItem := range orderItems {
+			if orderItem.Sent_at != nil {
+				if err := verifyManagerApproval(ctx, voidRequest.Manager_id, voidRequest.Manager_pin); err != nil {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+					return
+				}
+				approvedBy = voidRequest.Manager_id
+				break
+			}
+		}
+
+		voidedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := voidUpdate(voidRequest, approvedBy, voidedAt)
+
+		// Items are voided one by one, each only while it is in the state the
+		// approval was decided on: without a manager, one fired to the kitchen
+		// in the meantime is left alone.
+		for _, orderItem := range orderItems {
+			filter := bson.M{"order_item_id": orderItem.Order_item_id, "voided": bson.M{"$ne": true}}
+			if approvedBy == nil {
+				filter["sent_at"] = nil
+			}
+			result, err := orderItemCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+			if err != nil {
+				msg := fmt.Sprintf("order items void failed")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+			if result.ModifiedCount == 1 {
+				releaseVoidedItem(ctx, orderItem)
+			}
+		}
+
+		remaining, err := orderItemCollection.CountDocuments(ctx, itemFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking order items"})
+			return
+		}
+		if remaining > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "items were sent to the kitchen or added meanwhile; the order was not voided, please try again"})
+			return
+		}
+
+		// The order carries the same void details, minus the item-level flag.
+		orderUpdateObj := append(bson.D{{Key: "status", Value: "VOIDED"}}, updateObj[1:]...)
+		result, err := orderCollection.UpdateOne(ctx, bson.M{"order_id": orderId}, bson.D{{Key: "$set", Value: orderUpdateObj}})
+		if err != nil {
+			msg := fmt.Sprintf("order void failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// releaseVoidedItem gives back what a voided order item had taken: its
+// ingredients go back into stock and its portions back to its food.
+func releaseVoidedItem(ctx context.Context, orderItem models.OrderItem) {
+	restoreStock(ctx, orderItem)
+	if orderItem.Food_id != nil && orderItem.Quantity != nil {
+		releasePortions(ctx, map[string]int{*orderItem.Food_id: *orderItem.Quantity})
+	}
+}
+
+// voidUpdate builds the $set document shared by item and order voids.
+func voidUpdate(voidRequest VoidRequest, approvedBy *string, voidedAt time.Time) bson.D {
+	return bson.D{
+		{Key: "voided", Value: true},
+		{Key: "void_reason", Value: voidRequest.Reason_code},
+		{Key: "voided_by", Value: voidRequest.Staff_id},
+		{Key: "void_approved_by", Value: approvedBy},
+		{Key: "voided_at", Value: voidedAt},
+		{Key: "updated_at", Value: voidedAt},
+	}
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"log"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// moneyFields lists, per collection, the fields that used to hold float prices.
+// A "{}" suffix marks a map of prices; array fields list the money fields of
+// their elements after the colon.
+var moneyFields = map[string][]string{
+	"food":      {"price", "size_prices{}"},
+	"orderItem": {"unit_price"},
+	"order":     {"delivery_fee"},
+	"invoice": {
+		"payment_due", "subtotal", "service_charge", "delivery_fee", "grand_total",
+		"line_items:unit_price,amount", "discounts:amount", "taxes:taxable,amount",
+	},
+}
+
+// toMoney converts a float amount into minor units of currency. The float is
+// read as its shortest decimal form and rounded with models.Rounding, the same
+// ROUNDING_MODE every other amount is settled with.
+func toMoney(value float64, currency string) (models.Money, error) {
+	return models.ParseMoney(strconv.FormatFloat(value, 'f', -1, 64), currency)
+}
+
+// ifFloat only converts values that are still doubles, so the migration can be
+// run more than once. It reports whether the value was converted.
+func ifFloat(value interface{}, currency string) (interface{}, bool, error) {
+	amount, ok := value.(float64)
+	if !ok {
+		return value, false, nil
+	}
+	money, err := toMoney(amount, currency)
+	if err != nil {
+		return nil, false, err
+	}
+	return money, true, nil
+}
+
+// moneyFieldUpdate converts one field of a document, returning its new value
+// and whether anything in it changed.
+func moneyFieldUpdate(document bson.M, field string, currency string) (string, interface{}, bool, error) {
+	// "size_prices{}" is a map of size to price.
+	if name, ok := strings.CutSuffix(field, "{}"); ok {
+		prices, ok := document[name].(bson.M)
+		if !ok {
+			return name, nil, false, nil
+		}
+		changed := false
+		for size, price := range prices {
+			converted, ok, err := ifFloat(price, currency)
+			if err != nil {
+				return name, nil, false, fmt.Errorf("%s.%s: %w", name, size, err)
+			}
+			prices[size] = converted
+			changed = changed || ok
+		}
+		return name, prices, changed, nil
+	}
+
+	// "line_items:unit_price,amount" is an array whose elements hold money fields.
+	if name, subFields, ok := strings.Cut(field, ":"); ok {
+		elements, ok := document[name].(bson.A)
+		if !ok {
+			return name, nil, false, nil
+		}
+		changed := false
+		for i, element := range elements {
+			element, ok := element.(bson.M)
+			if !ok {
+				continue
+			}
+			for _, sub := range strings.Split(subFields, ",") {
+				converted, ok, err := ifFloat(element[sub], currency)
+				if err != nil {
+					return name, nil, false, fmt.Errorf("%s.%d.%s: %w", name, i, sub, err)
+				}
+				if ok {
+					element[sub] = converted
+					changed = true
+				}
+			}
+		}
+		return name, elements, changed, nil
+	}
+
+	converted, changed, err := ifFloat(document[field], currency)
+	if err != nil {
+		return field, nil, false, fmt.Errorf("%s: %w", field, err)
+	}
+	return field, converted, changed, nil
+}
+
+// MigrateFloatPrices rewrites every price that is still stored as a float into
+// the integer minor units and currency of models.Money. Documents already
+// migrated are left as they are.
+func MigrateFloatPrices(client *mongo.Client, currency string) error {
+	ctx := context.Background()
+
+	for collectionName, fields := range moneyFields {
+		collection := OpenCollection(client, collectionName)
+
+		projection := bson.M{}
+		for _, field := range fields {
+			name, _, _ := strings.Cut(strings.TrimSuffix(field, "{}"), ":")
+			projection[name] = 1
+		}
+		cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+		if err != nil {
+			return fmt.Errorf("migrating %s prices: %w", collectionName, err)
+		}
+
+		updated := 0
+		for cursor.Next(ctx) {
+			var document bson.M
+			if err := cursor.Decode(&document); err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("migrating %s prices: %w", collectionName, err)
+			}
+
+			set := bson.D{}
+			for _, field := range fields {
+				name, value, changed, err := moneyFieldUpdate(document, field, currency)
+				if err != nil {
+					cursor.Close(ctx)
+					return fmt.Errorf("migrating %s prices of %v: %w", collectionName, document["_id"], err)
+				}
+				if changed {
+					set = append(set, bson.E{Key: name, Value: value})
+				}
+			}
+			if len(set) == 0 {
+				continue
+			}
+
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": document["_id"]}, bson.D{{Key: "$set", Value: set}}); err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("migrating %s prices of %v: %w", collectionName, document["_id"], err)
+			}
+			updated++
+		}
+		if err := cursor.Err(); err != nil {
+			cursor.Close(ctx)
+			return fmt.Errorf("migrating %s prices: %w", collectionName, err)
+		}
+		cursor.Close(ctx)
+		log.Printf("migrated %s prices: %d documents updated", collectionName, updated)
+	}
+	return nil
+}
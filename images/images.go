@@ -0,0 +1,257 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels caps the size of an uploaded picture once decoded, so that a
+// small, highly compressed file cannot exhaust memory.
+const MaxPixels = 40_000_000
+
+// ErrUnsupportedType is returned for files that are not JPEG, PNG or WebP.
+var ErrUnsupportedType = errors.New("image must be a JPEG, PNG or WebP file")
+
+// Size is one of the variants generated from every upload.
+type Size struct {
+	Name       string
+	Max_width  int
+	Max_height int
+	Crop       bool // Fill the whole box, cutting off what does not fit
+}
+
+// Sizes are the variants generated for food images.
+var Sizes = []Size{
+	{Name: "thumbnail", Max_width: 200, Max_height: 200, Crop: true},
+	{Name: "card", Max_width: 640, Max_height: 480},
+	{Name: "full", Max_width: 1600, Max_height: 1600},
+}
+
+// Variant is one re-encoded size of an uploaded picture.
+type Variant struct {
+	Name         string
+	Width        int
+	Height       int
+	Content_type string
+	Extension    string
+	Data         []byte
+}
+
+// Process checks that data is a picture this package can read and returns
+// one variant per entry of Sizes. Every variant is decoded and encoded
+// again, which drops EXIF, GPS and any other metadata; the EXIF orientation
+// of JPEG photos is applied to the pixels first so they still display the
+// right way up. Pictures with transparency stay PNG, everything else
+// becomes JPEG.
+func Process(data []byte) ([]Variant, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/webp" {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image could not be read: %w", err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("image must be at most %d pixels", MaxPixels)
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image could not be read: %w", err)
+	}
+
+	orientation := 1
+	if contentType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	transparent := contentType != "image/jpeg" && !isOpaque(source)
+
+	var variants []Variant
+	for _, size := range Sizes {
+		// Orientations 5 to 8 turn the picture on its side, so the box is
+		// turned with it until the pixels are rotated.
+		maxWidth, maxHeight := size.Max_width, size.Max_height
+		if orientation >= 5 {
+			maxWidth, maxHeight = maxHeight, maxWidth
+		}
+
+		resized := resize(source, maxWidth, maxHeight, size.Crop, transparent)
+		oriented := orient(resized, orientation)
+
+		variant := Variant{
+			Name:   size.Name,
+			Width:  oriented.Bounds().Dx(),
+			Height: oriented.Bounds().Dy(),
+		}
+		var encoded bytes.Buffer
+		if transparent {
+			variant.Content_type, variant.Extension = "image/png", ".png"
+			err = png.Encode(&encoded, oriented)
+		} else {
+			variant.Content_type, variant.Extension = "image/jpeg", ".jpg"
+			err = jpeg.Encode(&encoded, oriented, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s image could not be encoded: %w", size.Name, err)
+		}
+		variant.Data = encoded.Bytes()
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// resize scales src down to fit within maxWidth by maxHeight, or to fill it
+// exactly when crop is set. Pictures are never scaled up. Pictures that will
+// become JPEGs are laid over white so transparent areas do not turn black.
+func resize(src image.Image, maxWidth, maxHeight int, crop, transparent bool) *image.NRGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	srcRect := bounds
+
+	scale := min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	if crop {
+		scale = max(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	}
+	if scale > 1 {
+		scale = 1
+	}
+
+	dstWidth, dstHeight := max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+	if crop {
+		// Keep the middle of the picture in the box
+		cropWidth, cropHeight := min(dstWidth, maxWidth), min(dstHeight, maxHeight)
+		visibleWidth, visibleHeight := int(float64(cropWidth)/scale+0.5), int(float64(cropHeight)/scale+0.5)
+		left := bounds.Min.X + (width-visibleWidth)/2
+		top := bounds.Min.Y + (height-visibleHeight)/2
+		srcRect = image.Rect(left, top, left+visibleWidth, top+visibleHeight)
+		dstWidth, dstHeight = cropWidth, cropHeight
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	operator := draw.Src
+	if !transparent {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		operator = draw.Over
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, operator, nil)
+	return dst
+}
+
+// orient turns and flips img as EXIF orientation o asks.
+func orient(img *image.NRGBA, o int) *image.NRGBA {
+	if o < 2 || o > 8 {
+		return img
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if o >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // Mirrored
+				dx, dy = width-1-x, y
+			case 3: // Upside down
+				dx, dy = width-1-x, height-1-y
+			case 4: // Upside down and mirrored
+				dx, dy = x, height-1-y
+			case 5: // On its side and mirrored
+				dx, dy = y, x
+			case 6: // Needs turning clockwise
+				dx, dy = height-1-y, x
+			case 7: // On its other side and mirrored
+				dx, dy = height-1-y, width-1-x
+			case 8: // Needs turning anticlockwise
+				dx, dy = y, width-1-x
+			}
+			dst.SetNRGBA(dx, dy, img.NRGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG file, or 1 (as
+// taken) when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // Image data starts: no more metadata
+			return 1
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation finds tag 0x0112 in the first directory of an EXIF block.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var u16 func([]byte) int
+	var u32 func([]byte) int
+	switch string(tiff[:2]) {
+	case "II":
+		u16 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 }
+		u32 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24 }
+	case "MM":
+		u16 = func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+		u32 = func(b []byte) int { return int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3]) }
+	default:
+		return 1
+	}
+
+	directory := u32(tiff[4:8])
+	if directory < 8 || directory+2 > len(tiff) {
+		return 1
+	}
+	entries := u16(tiff[directory:])
+	for n := 0; n < entries; n++ {
+		entry := directory + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if u16(tiff[entry:]) == 0x0112 {
+			if o := u16(tiff[entry+8:]); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// isOpaque reports whether every pixel of img is fully opaque.
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	// Import local packages for DB, middleware, and route definitions
+	controller "golang-Hotel_Management/controllers"
 	"golang-Hotel_Management/database"
 	"golang-Hotel_Management/middleware"
+	"golang-Hotel_Management/models"
 	"golang-Hotel_Management/routes"
+	"log"
 	"os"
+	"time"
 
 	// Gin: HTTP web framework
 	"github.com/gin-gonic/gin"
@@ -18,6 +23,32 @@ import (
 var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
 
 func main() {
+	// "go run . migrate-money" converts float prices stored by older versions
+	// into integer minor units and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate-money" {
+		if err := database.MigrateFloatPrices(database.Client, models.DefaultCurrency); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Indexes the handlers rely on: unique keys for retried requests, legal
+	// numbers and billed orders, and the text index for catalogue search
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := middleware.EnsureIdempotencyIndexes(ctx); err != nil {
+		log.Fatal("idempotency indexes were not created: ", err)
+	}
+	if err := controller.EnsureDocumentNumbering(ctx); err != nil {
+		log.Fatal("document numbering is not set up: ", err)
+	}
+	if err := controller.EnsureInvoiceIndexes(ctx); err != nil {
+		log.Fatal("invoice indexes were not created: ", err)
+	}
+	if err := controller.EnsureSearchIndexes(ctx); err != nil {
+		log.Fatal("search indexes were not created: ", err)
+	}
+	cancel()
+
 	// Load port from environment variable, default to 8000 if not set
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -33,16 +64,35 @@ func main() {
 	// Setup public user authentication routes (e.g., login, signup)
 	routes.UserRoutes(router)
 
+	// Payment provider webhooks are verified by signature rather than a user token
+	routes.PaymentWebhookRoutes(router)
+
+	// Food images are public so that menus and <img> tags can load them
+	routes.ImageRoutes(router)
+
 	// Apply JWT-based authentication middleware to secure subsequent routes
 	router.Use(middleware.Authentication())
 
 	// Register all the API route groups
+	routes.UserPinRoutes(router)
 	routes.FoodRoutes(router)
 	routes.MenuRoutes(router)
 	routes.TableRoutes(router)
 	routes.OrderRoutes(router)
 	routes.OrderItemRoutes(router)
 	routes.InvoiceRoutes(router)
+	routes.PaymentRoutes(router)
+	routes.CreditNoteRoutes(router)
+	routes.KitchenRoutes(router)
+	routes.RestaurantRoutes(router)
+	routes.TaxRateRoutes(router)
+	routes.ShiftRoutes(router)
+	routes.TipRuleRoutes(router)
+	routes.InventoryRoutes(router)
+	routes.ReportRoutes(router)
+
+	// Future-dated price changes take effect without anyone at the till
+	controller.StartPriceScheduler(time.Minute)
 
 	// Start the server on the specified port
 	router.Run(":" + port)
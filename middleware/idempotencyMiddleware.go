@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"golang-Hotel_Management/database"
+	"golang-Hotel_Management/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IdempotencyHeader is the request header clients use to make a create call safe to retry.
+const IdempotencyHeader = "Idempotency-Key"
+
+var idempotencyCollection *mongo.Collection = database.OpenCollection(database.Client, "idempotency")
+
+// idempotencyWindow returns how long a stored response is replayed for.
+// It is read from IDEMPOTENCY_TTL (e.g. "24h", "30m") and defaults to 24 hours.
+func idempotencyWindow() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+// EnsureIdempotencyIndexes makes keys unique per method and URL path, so two
+// concurrent first requests cannot both run, and lets Mongo drop records once
+// their window has passed. It is called once at startup: without the unique
+// index retries would run twice, so the server must not start.
+func EnsureIdempotencyIndexes(ctx context.Context) error {
+	_, err := idempotencyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}, {Key: "method", Value: 1}, {Key: "path", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keys used to be unique across every path
+	_, err = idempotencyCollection.Indexes().DropOne(ctx, "key_1")
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Name == "IndexNotFound" {
+		return nil
+	}
+	return err
+}
+
+// sideEffectsKey is the context key set once a handler has done something
+// a retry must not do again.
+const sideEffectsKey = "idempotency_side_effects"
+
+// CommitSideEffects tells the Idempotency middleware that the handler has
+// done something that cannot be undone, such as charging a card, so that its
+// response is kept for retries even if it is a server error.
+func CommitSideEffects(c *gin.Context) {
+	c.Set(sideEffectsKey, true)
+}
+
+// responseRecorder keeps a copy of everything the handler writes.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response when a request arrives again with an
+// Idempotency-Key that was already used for the same method and URL path.
+// Reusing a key with a different body is rejected. Requests without the header
+// pass straight through.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "request body could not be read"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		now := time.Now()
+		record := models.IdempotencyRecord{
+			ID:           primitive.NewObjectID(),
+			Key:          key,
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			Request_hash: requestHash,
+			Created_at:   now,
+			Expires_at:   now.Add(idempotencyWindow()),
+		}
+
+		// Claim the key. If it is already taken this is a retry (or a misuse).
+		_, err = idempotencyCollection.InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			var existing models.IdempotencyRecord
+			err := idempotencyCollection.FindOne(ctx, bson.M{
+				"key":    key,
+				"method": record.Method,
+				"path":   record.Path,
+			}).Decode(&existing)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "idempotency record could not be read"})
+				return
+			}
+
+			if existing.Expires_at.After(now) {
+				replayIdempotentResponse(c, existing, requestHash)
+				return
+			}
+
+			// The window has passed but the TTL monitor has not removed the
+			// record yet, so the key is free to be claimed again.
+			idempotencyCollection.DeleteOne(ctx, bson.M{"_id": existing.ID})
+			_, err = idempotencyCollection.InsertOne(ctx, record)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "idempotency key could not be stored"})
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// A handler that panics must not leave the key in progress for the
+		// whole window, unless retrying would repeat what it already did; the
+		// panic carries on to the recovery middleware.
+		defer func() {
+			if r := recover(); r != nil {
+				if !c.GetBool(sideEffectsKey) {
+					idempotencyCollection.DeleteOne(ctx, bson.M{"_id": record.ID})
+				}
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		// Server errors are not remembered so that the client can retry them,
+		// unless the handler had already done something a retry would repeat.
+		if c.Writer.Status() >= http.StatusInternalServerError && !c.GetBool(sideEffectsKey) {
+			idempotencyCollection.DeleteOne(ctx, bson.M{"_id": record.ID})
+			return
+		}
+
+		_, err = idempotencyCollection.UpdateOne(ctx, bson.M{"_id": record.ID}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "completed", Value: true},
+			{Key: "status_code", Value: c.Writer.Status()},
+			{Key: "content_type", Value: c.Writer.Header().Get("Content-Type")},
+			{Key: "response_body", Value: recorder.body.Bytes()},
+		}}})
+		if err != nil {
+			log.Println("idempotent response was not stored:", err)
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose key has already been claimed.
+func replayIdempotentResponse(c *gin.Context, existing models.IdempotencyRecord, requestHash string) {
+	if existing.Request_hash != requestHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "idempotency key was already used with a different request"})
+		return
+	}
+
+	if !existing.Completed {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this idempotency key is still in progress"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.Status_code, existing.Content_type, existing.Response_body)
+	c.Abort()
+}
@@ -0,0 +1,15 @@
+package models
+
+// Bundle makes a food a combo meal: it is sold at the food's own price and
+// made of one item from each of its slots, e.g. a burger, fries and a drink.
+type Bundle struct {
+	Slots []BundleSlot `json:"slots" validate:"required,min=1,dive"`
+}
+
+// BundleSlot is one part of a bundle: a fixed item when it offers a single
+// food, or a choice among several.
+type BundleSlot struct {
+	Name     string   `json:"name" validate:"required,max=50"`                  // e.g. "Main", "Side", "Drink"
+	Food_ids []string `json:"food_ids" validate:"required,min=1,dive,required"` // Foods the guest picks from
+	Size     *string  `json:"size" validate:"omitempty,eq=S|eq=M|eq=L"`         // Size of the item served; the size the bundle is ordered in when nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditNote documents money given back against an invoice. The invoice itself
+// is never edited; each refund issues a new credit note that references it.
+type CreditNote struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Credit_note_id string             `json:"credit_note_id"`
+	Number         string             `json:"number"` // Legal number, consecutive per restaurant and fiscal year
+	Fiscal_year    int                `json:"fiscal_year"`
+	Sequence       int64              `json:"sequence"`
+	Invoice_id     string             `json:"invoice_id"` // The invoice being credited
+	Order_id       string             `json:"order_id"`
+	Restaurant_id  string             `json:"restaurant_id"`
+	Reason         string             `json:"reason"`
+	Staff_id       string             `json:"staff_id"`    // Who gave the refund
+	Approved_by    string             `json:"approved_by"` // Manager who approved it
+	Full           bool               `json:"full"`        // Whether everything paid on the invoice was refunded
+	Amount         Money              `json:"amount"`      // Total refunded, tax included
+	Taxes          []TaxLine          `json:"taxes"`       // Share of the invoice's taxes contained in Amount
+	Refunds        []Refund           `json:"refunds"`
+	Status         string             `json:"status"`           // PENDING while the money is paid back, then ISSUED, or VOIDED if none could be
+	Voided         bool               `json:"voided,omitempty"` // Nothing was refunded; kept so that the numbers show no gap
+	Void_reason    *string            `json:"void_reason,omitempty"`
+	Created_at     time.Time          `json:"created_at"`
+	Updated_at     time.Time          `json:"updated_at"`
+}
+
+// Refund is the part of a credit note paid back through one original payment.
+type Refund struct {
+	Payment_id     string `json:"payment_id"`
+	Method         string `json:"method"`
+	Amount         Money  `json:"amount"`
+	Provider       string `json:"provider,omitempty"`
+	Transaction_id string `json:"transaction_id,omitempty"`
+}
@@ -9,12 +9,68 @@ import (
 // Food represents a food item in the restaurant's menu.
 // It includes fields for name, price, image URL, and references to related entities (like menu).
 type Food struct {
-	ID         primitive.ObjectID `bson:"_id"`                                    // MongoDB document ID
-	Name       *string            `json:"name" validate:"required,min=2,max=100"` // Name of the food item (min 2, max 100 characters)
-	Price      *float64           `json:"price" validate:"required"`              // Price of the food item (required)
-	Food_image *string            `json:"food_image" validate:"required"`         // URL or reference to the image of the food (required)
-	Created_at time.Time          `json:"created_at"`                             // Timestamp when the item was created
-	Updated_at time.Time          `json:"updated_at"`                             // Timestamp when the item was last updated
-	Food_id    string             `json:"food_id"`                                // Human-readable unique ID for the food item
-	Menu_id    *string            `json:"menu_id" validate:"required"`            // Reference to the menu this food item belongs to
+	ID                   primitive.ObjectID     `bson:"_id"`                                                                                   // MongoDB document ID
+	Name                 *string                `json:"name" validate:"required,min=2,max=100"`                                                // Name of the food item (min 2, max 100 characters)
+	Description          *string                `json:"description" validate:"omitempty,max=1000"`                                             // Menu description, searched along with the name
+	Translations         map[string]Translation `json:"translations,omitempty" validate:"omitempty,dive"`                                      // Name and description in other languages, keyed by language tag (e.g. "fr", "de-CH")
+	Language             string                 `json:"language,omitempty" bson:"-"`                                                           // Language the name is in on reads
+	Price                *Money                 `json:"price" validate:"required"`                                                             // Regular (M) price of the food item (required)
+	Size_prices          map[string]Money       `json:"size_prices" validate:"omitempty,dive,keys,eq=S|eq=M|eq=L,endkeys"`                     // Optional per-size prices (S, M, L) overriding Price
+	Price_effective_from *time.Time             `json:"price_effective_from,omitempty"`                                                        // When the current prices took effect
+	Food_image           *string                `json:"food_image"`                                                                            // URL of the full-size image; set by uploading one to /foods/:food_id/image
+	Created_at           time.Time              `json:"created_at"`                                                                            // Timestamp when the item was created
+	Created_by           *string                `json:"created_by,omitempty"`                                                                  // Staff member who created the item, the author of its first price
+	Updated_at           time.Time              `json:"updated_at"`                                                                            // Timestamp when the item was last updated
+	Food_id              string                 `json:"food_id"`                                                                               // Human-readable unique ID for the food item
+	Menu_id              *string                `json:"menu_id" validate:"required"`                                                           // Reference to the menu this food item belongs to
+	Tax_category         *string                `json:"tax_category"`                                                                          // Tax category the food is taxed under (e.g. FOOD, ALCOHOL); STANDARD when empty
+	Sold_out             bool                   `json:"sold_out"`                                                                              // On the "86" list: the food cannot be ordered
+	Remaining_portions   *int                   `json:"remaining_portions" validate:"omitempty,min=0"`                                         // Portions left before the food sells out; unlimited when nil
+	Sold_out_at          *time.Time             `json:"sold_out_at,omitempty"`                                                                 // When the food was last marked sold out
+	Auto_sold_out        bool                   `json:"auto_sold_out,omitempty"`                                                               // Sold out by running out of portions rather than by the kitchen
+	Allergens            []string               `json:"allergens" validate:"omitempty,dive,allergen"`                                          // Allergens the food contains; nil when not yet declared, empty when it contains none
+	Dietary_tags         []string               `json:"dietary_tags" validate:"omitempty,dive,eq=VEGAN|eq=VEGETARIAN|eq=HALAL|eq=GLUTEN_FREE"` // Dietary suitability shown to guests
+	Nutrition            *Nutrition             `json:"nutrition,omitempty"`                                                                   // Optional nutrition facts per portion
+	Images               *FoodImages            `json:"images,omitempty"`                                                                      // Resized variants of the uploaded image
+	Bundle               *Bundle                `json:"bundle,omitempty"`                                                                      // Makes the food a combo of the items in its slots
+	Archived             bool                   `json:"archived,omitempty"`                                                                    // Taken off its menu by publishing a version without it; kept for the orders and reports naming it
+	Archived_at          *time.Time             `json:"archived_at,omitempty"`
+}
+
+// Allergens are the 14 allergens that EU food law requires to be declared.
+var Allergens = []string{
+	"CELERY", "GLUTEN", "CRUSTACEANS", "EGGS", "FISH", "LUPIN", "MILK",
+	"MOLLUSCS", "MUSTARD", "NUTS", "PEANUTS", "SESAME", "SOYA", "SULPHITES",
+}
+
+// IsAllergen reports whether value is one of the declared Allergens.
+func IsAllergen(value string) bool {
+	for _, allergen := range Allergens {
+		if allergen == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FoodImages are the URLs of the variants generated from an uploaded image.
+type FoodImages struct {
+	Thumbnail   string    `json:"thumbnail"`
+	Card        string    `json:"card"`
+	Full        string    `json:"full"`
+	Keys        []string  `json:"-"` // Storage keys of the variants, removed when the image is replaced
+	Uploaded_at time.Time `json:"uploaded_at"`
+}
+
+// Nutrition holds the nutrition facts of one portion of a food.
+type Nutrition struct {
+	Portion_g      *float64 `json:"portion_g" validate:"omitempty,gt=0"` // Weight of the portion the facts are for
+	Energy_kcal    *float64 `json:"energy_kcal" validate:"omitempty,min=0"`
+	Fat_g          *float64 `json:"fat_g" validate:"omitempty,min=0"`
+	Saturates_g    *float64 `json:"saturates_g" validate:"omitempty,min=0"`
+	Carbohydrate_g *float64 `json:"carbohydrate_g" validate:"omitempty,min=0"`
+	Sugars_g       *float64 `json:"sugars_g" validate:"omitempty,min=0"`
+	Fibre_g        *float64 `json:"fibre_g" validate:"omitempty,min=0"`
+	Protein_g      *float64 `json:"protein_g" validate:"omitempty,min=0"`
+	Salt_g         *float64 `json:"salt_g" validate:"omitempty,min=0"`
 }
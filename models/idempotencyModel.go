@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IdempotencyRecord stores the first response given for an Idempotency-Key so
+// that retried requests carrying the same key can be answered with it again.
+type IdempotencyRecord struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Key           string             `bson:"key"`
+	Method        string             `bson:"method"`
+	Path          string             `bson:"path"`
+	Request_hash  string             `bson:"request_hash"`
+	Completed     bool               `bson:"completed"`
+	Status_code   int                `bson:"status_code"`
+	Content_type  string             `bson:"content_type"`
+	Response_body []byte             `bson:"response_body"`
+	Created_at    time.Time          `bson:"created_at"`
+	Expires_at    time.Time          `bson:"expires_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ingredient is an item of stock the kitchen cooks with. Stock is kept in the
+// ingredient's own unit, and recipes give their quantities in that unit too.
+type Ingredient struct {
+	ID                  primitive.ObjectID `bson:"_id"`
+	Ingredient_id       string             `json:"ingredient_id"`
+	Name                *string            `json:"name" validate:"required,min=2,max=100"`
+	Unit                *string            `json:"unit" validate:"required,eq=g|eq=kg|eq=ml|eq=l|eq=pcs"`
+	Stock_on_hand       float64            `json:"stock_on_hand"`                                  // Changed only through stock movements
+	Low_stock_threshold *float64           `json:"low_stock_threshold" validate:"omitempty,min=0"` // Alert once stock falls to this level; no alerts when nil
+	Low_stock           bool               `json:"low_stock"`                                      // Stock is at or below the threshold
+	Created_at          time.Time          `json:"created_at"`
+	Updated_at          time.Time          `json:"updated_at"`
+}
+
+// StockMovement is one line of the stock ledger. Quantity is the signed change
+// to the ingredient's stock and Balance_after what was on hand after it.
+type StockMovement struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Movement_id   string             `json:"movement_id"`
+	Ingredient_id string             `json:"ingredient_id"`
+	Type          string             `json:"type"` // SALE, VOID, ORDER_CHANGE, COUNT, DELIVERY, WASTE or ADJUSTMENT
+	Quantity      float64            `json:"quantity"`
+	Balance_after float64            `json:"balance_after"`
+	Reason        *string            `json:"reason,omitempty"`
+	Order_item_id *string            `json:"order_item_id,omitempty"` // Set for movements caused by orders
+	Staff_id      *string            `json:"staff_id,omitempty"`
+	Created_at    time.Time          `json:"created_at"`
+}
+
+// StockAlert is raised when an ingredient falls to its low-stock threshold and
+// resolved once stock is back above it.
+type StockAlert struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Stock_alert_id string             `json:"stock_alert_id"`
+	Ingredient_id  string             `json:"ingredient_id"`
+	Name           string             `json:"name"`
+	Stock_on_hand  float64            `json:"stock_on_hand"` // Stock when the alert was raised
+	Threshold      float64            `json:"threshold"`
+	Raised_at      time.Time          `json:"raised_at"`
+	Resolved_at    *time.Time         `json:"resolved_at"`
+}
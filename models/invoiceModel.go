@@ -7,15 +7,69 @@ import (
 )
 
 type Invoice struct {
-	ID               primitive.ObjectID `bson:"_id"`
-	Invoice_id       string             `json:"invoice_id"`
-	Order_id         string             `json:"order_id"`
-	Payment_method   *string            `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
-	Payment_status   *string            `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
-	Payment_due_date time.Time          `json:"Payment_due_date"`
-	Created_at       time.Time          `json:"created_at"`
-	Updated_at       time.Time          `json:"updated_at"`
-	Payment_due      interface{}        `json:"payment_due"`
-	Table_number     interface{}        `json:"table_number"`
-	Order_details    interface{}        `json:"order_details"`
+	ID                 primitive.ObjectID `bson:"_id"`
+	Invoice_id         string             `json:"invoice_id"`
+	Invoice_number     string             `json:"invoice_number"` // Legal number, consecutive per restaurant and fiscal year
+	Fiscal_year        int                `json:"fiscal_year"`
+	Sequence           int64              `json:"sequence"`
+	Order_id           string             `json:"order_id"`
+	Payment_method     *string            `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
+	Payment_status     *string            `json:"payment_status" validate:"required,eq=PENDING|eq=PARTIALLY_PAID|eq=PAID|eq=OVERPAID|eq=PARTIALLY_REFUNDED|eq=REFUNDED"` // Derived from the invoice's payments
+	Payment_due_date   time.Time          `json:"Payment_due_date"`
+	Created_at         time.Time          `json:"created_at"`
+	Updated_at         time.Time          `json:"updated_at"`
+	Payment_due        Money              `json:"payment_due"`
+	Table_number       interface{}        `json:"table_number"`
+	Line_items         []InvoiceLine      `json:"line_items"`
+	Subtotal           Money              `json:"subtotal"`
+	Discounts          []InvoiceDiscount  `json:"discounts"`
+	Service_charge     Money              `json:"service_charge"`
+	Taxes              []TaxLine          `json:"taxes"`
+	Delivery_fee       Money              `json:"delivery_fee"`
+	Grand_total        Money              `json:"grand_total"`
+	Restaurant_id      string             `json:"restaurant_id"`
+	Prices_include_tax bool               `json:"prices_include_tax"`
+	Split_type         *string            `json:"split_type,omitempty"`  // ITEMS, SEATS or EVEN when the order's bill was split
+	Split_part         int                `json:"split_part,omitempty"`  // 1-based position of this invoice among the split
+	Split_count        int                `json:"split_count,omitempty"` // Number of invoices the order was split into
+	Amount_paid        Money              `json:"amount_paid"`           // Sum of the payments taken
+	Balance_due        Money              `json:"balance_due"`           // Payment_due less Amount_paid, negative when overpaid
+	Amount_refunded    Money              `json:"amount_refunded"`       // Sum of the credit notes issued against the invoice
+	Voided             bool               `json:"voided"`                // Cancelled invoices are kept, never deleted, so that no number goes missing
+	Void_reason        *string            `json:"void_reason,omitempty"`
+	Voided_by          *string            `json:"voided_by,omitempty"`
+	Voided_at          *time.Time         `json:"voided_at,omitempty"`
+}
+
+// InvoiceLine is one billed order item, copied from the order when the invoice
+// is issued so that later food price changes do not alter it.
+type InvoiceLine struct {
+	Order_item_id string `json:"order_item_id"`
+	Food_id       string `json:"food_id"`
+	Name          string `json:"name"`
+	Size          string `json:"size"`
+	Quantity      int    `json:"quantity"`
+	Seat          int    `json:"seat,omitempty"`
+	Tax_category  string `json:"tax_category"`
+	Unit_price    Money  `json:"unit_price"`
+	Amount        Money  `json:"amount"`
+}
+
+// InvoiceDiscount is a discount taken off the subtotal. Either Percentage or
+// Amount is given when the invoice is created; Amount is always set once priced.
+type InvoiceDiscount struct {
+	Description string   `json:"description" validate:"required"`
+	Percentage  *float64 `json:"percentage,omitempty" validate:"omitempty,gt=0,lte=100"`
+	Amount      Money    `json:"amount"`
+}
+
+// TaxLine is the tax charged at one rate. Taxable is the net amount the rate
+// was applied to, whether prices were tax-inclusive or not.
+type TaxLine struct {
+	Tax_rate_id string  `json:"tax_rate_id"`
+	Category    string  `json:"category"`
+	Name        string  `json:"name"`
+	Rate        float64 `json:"rate"`
+	Taxable     Money   `json:"taxable"`
+	Amount      Money   `json:"amount"`
 }
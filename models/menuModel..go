@@ -7,12 +7,26 @@ import (
 )
 
 type Menu struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Name       string             `json:"name" validate:"required"`
-	Category   string             `json:"category" validate:"required"`
-	Start_Date *time.Time         `json:"start_date"`
-	End_Date   *time.Time         `json:"end_date"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Menu_id    string             `json:"food_id"`
+	ID           primitive.ObjectID     `bson:"_id"`
+	Name         string                 `json:"name" validate:"required"`
+	Category     string                 `json:"category" validate:"required"`
+	Description  string                 `json:"description" validate:"omitempty,max=1000"`
+	Translations map[string]Translation `json:"translations,omitempty" validate:"omitempty,dive"` // Name and description in other languages, keyed by language tag (e.g. "fr", "de-CH")
+	Language     string                 `json:"language,omitempty" bson:"-"`                      // Language the name is in on reads
+	Start_Date   *time.Time             `json:"start_date"`                                       // First moment the menu can be sold, open-ended when nil
+	End_Date     *time.Time             `json:"end_date"`                                         // Moment the menu stops being sold, open-ended when nil
+	Schedule     []MenuWindow           `json:"schedule" validate:"omitempty,dive"`               // Weekly hours; the menu is sold all day when empty
+	Timezone     string                 `json:"timezone" validate:"omitempty,timezone"`           // IANA zone the schedule is in, TIMEZONE or the server's when empty
+	Created_at   time.Time              `json:"created_at"`
+	Updated_at   time.Time              `json:"updated_at"`
+	Menu_id      string                 `json:"menu_id"`
+}
+
+// MenuWindow is a time of day the menu is sold on some days of the week, e.g.
+// breakfast 07:00-11:00 Monday to Friday. A window whose End is not after its
+// Start runs past midnight into the next day.
+type MenuWindow struct {
+	Days  []string `json:"days" validate:"required,min=1,dive,eq=MON|eq=TUE|eq=WED|eq=THU|eq=FRI|eq=SAT|eq=SUN"`
+	Start string   `json:"start" validate:"required,datetime=15:04"`
+	End   string   `json:"end" validate:"required,datetime=15:04"`
 }
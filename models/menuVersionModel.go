@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MenuVersion is a copy of a menu together with its foods. Managers edit a
+// DRAFT without touching what guests see, then publish it in one go; the
+// version on the floor is PUBLISHED, and the ones it replaced are kept as
+// SUPERSEDED so that any of them can be put back.
+type MenuVersion struct {
+	ID               primitive.ObjectID    `bson:"_id"`
+	Menu_version_id  string                `json:"menu_version_id"`
+	Menu_id          string                `json:"menu_id"`
+	Version          int                   `json:"version"`                    // Numbered from 1 in publishing order; 0 while a draft
+	Status           string                `json:"status"`                     // DRAFT, PUBLISHED or SUPERSEDED
+	Based_on         int                   `json:"based_on"`                   // Version the draft was started from
+	Revision         int                   `json:"revision"`                   // Counts the edits to a draft, so that two managers cannot overwrite each other
+	Rolled_back_from *int                  `json:"rolled_back_from,omitempty"` // Version it is a republished copy of
+	Menu             Menu                  `json:"menu"`
+	Foods            []Food                `json:"foods"`
+	Base_prices      map[string]FoodPrices `json:"base_prices,omitempty"` // Prices of the draft's foods when it was started; a food still at them keeps the live price, which scheduled changes may have moved
+	Created_by       *string               `json:"created_by"`
+	Published_by     *string               `json:"published_by,omitempty"`
+	Published_at     *time.Time            `json:"published_at,omitempty"`
+	Created_at       time.Time             `json:"created_at"`
+	Updated_at       time.Time             `json:"updated_at"`
+}
+
+// FoodPrices are the regular and per-size prices of a food.
+type FoodPrices struct {
+	Price       *Money           `json:"price"`
+	Size_prices map[string]Money `json:"size_prices,omitempty"`
+}
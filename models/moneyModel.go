@@ -0,0 +1,185 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Rounding modes applied when a money amount is multiplied by a rate.
+const (
+	RoundHalfUp   = "HALF_UP"   // 0.5 cents rounds away from zero
+	RoundHalfEven = "HALF_EVEN" // banker's rounding: 0.5 cents rounds to the even cent
+)
+
+// DefaultCurrency is the ISO 4217 code used when none is given, read from CURRENCY.
+var DefaultCurrency = envOrDefault("CURRENCY", "EUR")
+
+// Rounding is the rounding mode for money calculations, read from ROUNDING_MODE.
+var Rounding = envOrDefault("ROUNDING_MODE", RoundHalfUp)
+
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return strings.ToUpper(value)
+	}
+	return def
+}
+
+// Money is an exact amount in integer minor units (cents) of a currency.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount" validate:"gte=0"`               // Minor units, e.g. 1250 for 12.50
+	Currency string `json:"currency" bson:"currency" validate:"omitempty,len=3"` // ISO 4217 code, e.g. EUR
+}
+
+// NewMoney returns an amount in minor units of the default currency.
+func NewMoney(amount int64) Money {
+	return Money{Amount: amount, Currency: DefaultCurrency}
+}
+
+// ParseMoney reads a decimal string such as "12.50" exactly into minor units.
+func ParseMoney(value string, currency string) (Money, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return Money{}, fmt.Errorf("%q is not a valid amount", value)
+	}
+	rat.Mul(rat, big.NewRat(100, 1))
+	return Money{Amount: roundRat(rat, Rounding), Currency: currency}, nil
+}
+
+// Add returns m + other.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currency(other)}
+}
+
+// Sub returns m - other.
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currency(other)}
+}
+
+// Mul returns m multiplied by a whole quantity.
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// MulRate returns m multiplied by a decimal rate such as 0.075, rounded to the
+// cent with the configured rounding mode. The rate is read as its shortest
+// decimal form so that 0.1 means exactly one tenth.
+func (m Money) MulRate(rate float64) Money {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	r.Mul(r, new(big.Rat).SetInt64(m.Amount))
+	return Money{Amount: roundRat(r, Rounding), Currency: m.Currency}
+}
+
+// InclusiveTax returns the tax contained in m when m already includes tax at
+// the given rate, i.e. m * rate / (1 + rate), rounded with the configured mode.
+func (m Money) InclusiveTax(rate float64) Money {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	share := new(big.Rat).Quo(r, new(big.Rat).Add(r, big.NewRat(1, 1)))
+	share.Mul(share, new(big.Rat).SetInt64(m.Amount))
+	return Money{Amount: roundRat(share, Rounding), Currency: m.Currency}
+}
+
+// Allocate divides m into parts proportional to the given weights. The parts
+// always add back up to m exactly: cents lost to rounding down are handed out
+// one each, starting with the first part. m is expected to be non-negative.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	var total int64
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		for i := range parts {
+			parts[i] = Money{Currency: m.Currency}
+		}
+		if len(parts) > 0 {
+			parts[0].Amount = m.Amount
+		}
+		return parts
+	}
+
+	allocated := int64(0)
+	for i, weight := range weights {
+		share := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(weight))
+		share.Quo(share, big.NewInt(total))
+		parts[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+		allocated += parts[i].Amount
+	}
+	for i := 0; allocated < m.Amount; i = (i + 1) % len(parts) {
+		if weights[i] > 0 {
+			parts[i].Amount++
+			allocated++
+		}
+	}
+	return parts
+}
+
+// Split divides m into n equal parts that add back up to m exactly; the
+// leftover cents go one each to the first parts.
+func (m Money) Split(n int) []Money {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return m.Allocate(weights)
+}
+
+// Min returns the smaller of m and other.
+func (m Money) Min(other Money) Money {
+	if other.Amount < m.Amount {
+		return Money{Amount: other.Amount, Currency: m.currency(other)}
+	}
+	return m
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// String formats the amount with two decimals and its currency, e.g. "12.50 EUR".
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, m.Currency)
+}
+
+// currency keeps the currency of whichever side has one.
+func (m Money) currency(other Money) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return other.Currency
+}
+
+// roundRat rounds a rational number of minor units to a whole number of them.
+func roundRat(r *big.Rat, mode string) int64 {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	twice := new(big.Int).Mul(remainder, big.NewInt(2))
+
+	switch twice.Cmp(den) {
+	case 1:
+		quotient.Add(quotient, big.NewInt(1))
+	case 0:
+		if mode != RoundHalfEven || quotient.Bit(0) == 1 {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return quotient.Int64()
+}
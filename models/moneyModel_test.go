@@ -0,0 +1,167 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// withRounding runs the test with the given rounding mode and puts the
+// configured one back afterwards.
+func withRounding(t *testing.T, mode string) {
+	t.Helper()
+	previous := Rounding
+	Rounding = mode
+	t.Cleanup(func() { Rounding = previous })
+}
+
+func amounts(parts []Money) []int64 {
+	result := make([]int64, len(parts))
+	for i, part := range parts {
+		result[i] = part.Amount
+	}
+	return result
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		rate   float64
+		mode   string
+		want   int64
+	}{
+		{"exact", 1000, 0.075, RoundHalfUp, 75},
+		{"below half", 333, 0.1, RoundHalfUp, 33},
+		{"half up from odd", 1250, 0.07, RoundHalfUp, 88},
+		{"half even from odd", 1250, 0.07, RoundHalfEven, 88},
+		{"half up from even", 1050, 0.05, RoundHalfUp, 53},
+		{"half even from even", 1050, 0.05, RoundHalfEven, 52},
+		{"half up of one cent", 1, 0.5, RoundHalfUp, 1},
+		{"half even of one cent", 1, 0.5, RoundHalfEven, 0},
+		{"negative half up", -1050, 0.05, RoundHalfUp, -53},
+		{"negative half even", -1050, 0.05, RoundHalfEven, -52},
+		{"decimal rate", 1000, 0.1, RoundHalfUp, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withRounding(t, tt.mode)
+			got := Money{Amount: tt.amount, Currency: "EUR"}.MulRate(tt.rate)
+			if got.Amount != tt.want || got.Currency != "EUR" {
+				t.Errorf("MulRate(%v) of %d = %v, want %d EUR", tt.rate, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInclusiveTax(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		rate   float64
+		mode   string
+		want   int64
+	}{
+		{"exact", 1190, 0.19, RoundHalfUp, 190},
+		{"rounds up", 1000, 0.2, RoundHalfUp, 167},
+		{"rounds down", 1000, 0.07, RoundHalfUp, 65},
+		{"zero rate", 1000, 0, RoundHalfUp, 0},
+		{"half up", 5, 1, RoundHalfUp, 3},
+		{"half even", 5, 1, RoundHalfEven, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withRounding(t, tt.mode)
+			got := Money{Amount: tt.amount, Currency: "EUR"}.InclusiveTax(tt.rate)
+			if got.Amount != tt.want {
+				t.Errorf("InclusiveTax(%v) of %d = %d, want %d", tt.rate, tt.amount, got.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value   string
+		mode    string
+		want    int64
+		wantErr bool
+	}{
+		{"12.50", RoundHalfUp, 1250, false},
+		{" 3 ", RoundHalfUp, 300, false},
+		{"12.345", RoundHalfUp, 1235, false},
+		{"12.345", RoundHalfEven, 1234, false},
+		{"0.125", RoundHalfEven, 12, false},
+		{"0.135", RoundHalfEven, 14, false},
+		{"-0.125", RoundHalfUp, -13, false},
+		{"twelve", RoundHalfUp, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.mode, func(t *testing.T) {
+			withRounding(t, tt.mode)
+			got, err := ParseMoney(tt.value, "EUR")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got.Amount != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.value, got.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"equal weights", 1000, []int64{1, 1, 1}, []int64{334, 333, 333}},
+		{"proportional", 999, []int64{500, 300, 200}, []int64{500, 300, 199}},
+		{"zero weight gets nothing", 3, []int64{1, 0, 1}, []int64{2, 0, 1}},
+		{"only weighted part", 100, []int64{0, 1}, []int64{0, 100}},
+		{"no weights at all", 100, []int64{0, 0}, []int64{100, 0}},
+		{"zero amount", 0, []int64{2, 1}, []int64{0, 0}},
+		{"no parts", 100, []int64{}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := Money{Amount: tt.amount, Currency: "EUR"}.Allocate(tt.weights)
+			if got := amounts(parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate(%v) of %d = %v, want %v", tt.weights, tt.amount, got, tt.want)
+			}
+			for _, part := range parts {
+				if part.Currency != "EUR" {
+					t.Errorf("Allocate part %v lost the currency", part)
+				}
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		amount int64
+		n      int
+		want   []int64
+	}{
+		{1000, 3, []int64{334, 333, 333}},
+		{100, 4, []int64{25, 25, 25, 25}},
+		{2, 3, []int64{1, 1, 0}},
+		{1001, 1, []int64{1001}},
+	}
+	for _, tt := range tests {
+		parts := Money{Amount: tt.amount, Currency: "EUR"}.Split(tt.n)
+		got := amounts(parts)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%d) of %d = %v, want %v", tt.n, tt.amount, got, tt.want)
+		}
+		var total int64
+		for _, amount := range got {
+			total += amount
+		}
+		if total != tt.amount {
+			t.Errorf("Split(%d) of %d adds up to %d", tt.n, tt.amount, total)
+		}
+	}
+}
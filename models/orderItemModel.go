@@ -7,12 +7,31 @@ import (
 )
 
 type OrderItem struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	Quantity      *string            `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
-	Unit_price    *float64           `json:"unit_price" validate:"required"`
-	Created_at    time.Time          `json:"created_at"`
-	Updated_at    time.Time          `json:"updated_at"`
-	Food_id       *string            `json:"food_id" validate:"required"`
-	Order_item_id string             `json:"order_item_id"`
-	Order_id      string             `json:"order_id" validate:"required"`
+	ID               primitive.ObjectID `bson:"_id"`
+	Quantity         *int               `json:"quantity" validate:"required,min=1"`
+	Size             *string            `json:"size" validate:"required,eq=S|eq=M|eq=L"`
+	Unit_price       *Money             `json:"unit_price"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Food_id          *string            `json:"food_id" validate:"required"`
+	Order_item_id    string             `json:"order_item_id"`
+	Order_id         string             `json:"order_id" validate:"required"`
+	Course           *int               `json:"course" validate:"omitempty,min=1"`
+	Seat             *int               `json:"seat" validate:"omitempty,min=1"`
+	Held             bool               `json:"held"`
+	Sent_at          *time.Time         `json:"sent_at"`
+	Served_at        *time.Time         `json:"served_at"`
+	Voided           bool               `json:"voided"`
+	Void_reason      *string            `json:"void_reason"`
+	Voided_by        *string            `json:"voided_by"`
+	Void_approved_by *string            `json:"void_approved_by"`
+	Voided_at        *time.Time         `json:"voided_at"`
+	Allergy          bool               `json:"allergy"`                                            // The guest has an allergy; the item is highlighted on kitchen tickets
+	Guest_allergens  []string           `json:"guest_allergens" validate:"omitempty,dive,allergen"` // Allergens the guest must avoid
+	Allergy_note     *string            `json:"allergy_note" validate:"omitempty,max=200"`
+	Choices          map[string]string  `json:"choices,omitempty"`         // For bundles: the food chosen for each slot that offers a choice, by slot name
+	Bundle           bool               `json:"bundle"`                    // A bundle billed at its own price; its components are cooked
+	Bundle_item_id   *string            `json:"bundle_item_id,omitempty"`  // On components: the bundle order item they are part of
+	Bundle_slot      *string            `json:"bundle_slot,omitempty"`     // On components: the slot they fill
+	Allocated_price  *Money             `json:"allocated_price,omitempty"` // On components: their share of the bundle's unit price, for reporting
 }
@@ -8,14 +8,44 @@ import (
 
 // Order represents a customer's order in the system
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"`
-	Order_id   string             `json:"order_id" bson:"order_id"`
-	Name       string             `json:"name" bson:"name" validate:"required"`
-	Category   string             `json:"category" bson:"category" validate:"required"`
-	Start_Date *time.Time         `json:"start_date" bson:"start_date,omitempty"`
-	End_Date   *time.Time         `json:"end_date" bson:"end_date,omitempty"`
-	Created_at time.Time          `json:"created_at" bson:"created_at"`
-	Updated_at time.Time          `json:"updated_at" bson:"updated_at"`
-	Menu_id    string             `json:"menu_id,omitempty" bson:"menu_id,omitempty"`
-	Table_id   *string            `json:"table_id,omitempty" bson:"table_id,omitempty"`
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	Order_id         string             `json:"order_id" bson:"order_id"`
+	Name             string             `json:"name" bson:"name" validate:"required"`
+	Category         string             `json:"category" bson:"category" validate:"required"`
+	Start_Date       *time.Time         `json:"start_date" bson:"start_date,omitempty"`
+	End_Date         *time.Time         `json:"end_date" bson:"end_date,omitempty"`
+	Created_at       time.Time          `json:"created_at" bson:"created_at"`
+	Updated_at       time.Time          `json:"updated_at" bson:"updated_at"`
+	Menu_id          string             `json:"menu_id,omitempty" bson:"menu_id,omitempty"`
+	Table_id         *string            `json:"table_id,omitempty" bson:"table_id,omitempty"`
+	Status           string             `json:"status" bson:"status"`
+	Void_reason      *string            `json:"void_reason,omitempty" bson:"void_reason,omitempty"`
+	Voided_by        *string            `json:"voided_by,omitempty" bson:"voided_by,omitempty"`
+	Void_approved_by *string            `json:"void_approved_by,omitempty" bson:"void_approved_by,omitempty"`
+	Voided_at        *time.Time         `json:"voided_at,omitempty" bson:"voided_at,omitempty"`
+	Restaurant_id    *string            `json:"restaurant_id,omitempty" bson:"restaurant_id,omitempty"`
+	Course_timings   []CourseTiming     `json:"course_timings,omitempty" bson:"course_timings,omitempty"`
+	Fulfilment       `bson:",inline"`
+}
+
+// CourseTiming records when a course was fired to the kitchen and when it was
+// served, so that the pacing of set dinners can be analysed.
+type CourseTiming struct {
+	Course    int        `json:"course" bson:"course"`
+	Fired_at  time.Time  `json:"fired_at" bson:"fired_at"`
+	Fired_by  *string    `json:"fired_by,omitempty" bson:"fired_by,omitempty"`
+	Served_at *time.Time `json:"served_at,omitempty" bson:"served_at,omitempty"`
+}
+
+// Fulfilment describes how an order leaves the kitchen: its type and, for
+// orders that are not eaten in, who it is for and when and where it goes.
+type Fulfilment struct {
+	Order_type       string     `json:"order_type" bson:"order_type" validate:"omitempty,eq=DINE_IN|eq=TAKEAWAY|eq=DELIVERY|eq=ROOM_SERVICE"`
+	Customer_name    *string    `json:"customer_name,omitempty" bson:"customer_name,omitempty"`
+	Customer_phone   *string    `json:"customer_phone,omitempty" bson:"customer_phone,omitempty" validate:"omitempty,min=6,max=20"`
+	Pickup_time      *time.Time `json:"pickup_time,omitempty" bson:"pickup_time,omitempty"`
+	Delivery_time    *time.Time `json:"delivery_time,omitempty" bson:"delivery_time,omitempty"`
+	Delivery_address *string    `json:"delivery_address,omitempty" bson:"delivery_address,omitempty"`
+	Room_number      *string    `json:"room_number,omitempty" bson:"room_number,omitempty"`
+	Delivery_fee     Money      `json:"delivery_fee" bson:"delivery_fee"`
 }
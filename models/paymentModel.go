@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment is one tender taken against an invoice. An invoice can be paid with
+// several of them, e.g. part cash and part card.
+type Payment struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Payment_id string             `json:"payment_id"`
+	Invoice_id string             `json:"invoice_id"`
+	Method     *string            `json:"method" validate:"required,eq=CASH|eq=CARD|eq=VOUCHER|eq=ROOM_CHARGE"`
+	Amount     Money              `json:"amount"`              // Amount applied to the invoice
+	Tendered   Money              `json:"tendered"`            // Amount handed over; only differs from Amount for cash
+	Change     Money              `json:"change"`              // Cash given back to the guest
+	Tip        Money              `json:"tip"`                 // Gratuity on top of Amount, not counted towards the invoice
+	Tip_outs   []TipOut           `json:"tip_outs,omitempty"`  // Tip rules in force when the tip was taken
+	Refunded   Money              `json:"refunded"`            // Total paid back through this payment by credit notes
+	Reference  *string            `json:"reference,omitempty"` // Card slip, voucher code or room number
+	Staff_id   *string            `json:"staff_id" validate:"required"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+
+	Card_token     string `json:"card_token,omitempty" bson:"-"` // Only sent by the client, never stored
+	Provider       string `json:"provider,omitempty"`            // Gateway that processed a card payment
+	Transaction_id string `json:"transaction_id,omitempty"`      // The gateway's id for the payment
+	Status         string `json:"status"`                        // PENDING, AUTHORIZED, CAPTURED, DECLINED or VOIDED; only CAPTURED counts
+	Decline_reason string `json:"decline_reason,omitempty"`
+}
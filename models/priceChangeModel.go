@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PriceChange is one entry of a food's price history. A change dated in the
+// future waits as SCHEDULED until its Effective_from comes round and is then
+// applied to the food; the applied changes, in order, are what the food cost
+// at any moment.
+type PriceChange struct {
+	ID                   primitive.ObjectID `bson:"_id"`
+	Price_change_id      string             `json:"price_change_id"`
+	Food_id              string             `json:"food_id"`
+	Price                *Money             `json:"price"`                                                             // New regular price; unchanged when nil
+	Size_prices          map[string]Money   `json:"size_prices" validate:"omitempty,dive,keys,eq=S|eq=M|eq=L,endkeys"` // New per-size prices; unchanged when nil
+	Previous_price       *Money             `json:"previous_price,omitempty"`                                          // Regular price replaced when the change was applied
+	Previous_size_prices map[string]Money   `json:"previous_size_prices,omitempty"`
+	Effective_from       time.Time          `json:"effective_from"`
+	Status               string             `json:"status"`                   // SCHEDULED, APPLIED, CANCELLED or FAILED
+	Failure_reason       *string            `json:"failure_reason,omitempty"` // Why a due change could not be applied
+	Changed_by           *string            `json:"changed_by"`
+	Reason               *string            `json:"reason,omitempty"`
+	Applied_at           *time.Time         `json:"applied_at,omitempty"`
+	Cancelled_by         *string            `json:"cancelled_by,omitempty"`
+	Cancelled_at         *time.Time         `json:"cancelled_at,omitempty"`
+	Created_at           time.Time          `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recipe lists the ingredients that go into one portion of a food. Each
+// portion ordered takes these quantities out of stock.
+type Recipe struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Recipe_id   string             `json:"recipe_id"`
+	Food_id     string             `json:"food_id"`
+	Ingredients []RecipeIngredient `json:"ingredients" validate:"required,min=1,dive"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
+
+// RecipeIngredient is the quantity of an ingredient in one portion, in the
+// ingredient's unit.
+type RecipeIngredient struct {
+	Ingredient_id *string  `json:"ingredient_id" validate:"required"`
+	Quantity      *float64 `json:"quantity" validate:"required,gt=0"`
+}
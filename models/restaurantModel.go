@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Restaurant holds the settings of one outlet (restaurant, bar, ...) that
+// invoices are issued for.
+type Restaurant struct {
+	ID                        primitive.ObjectID `bson:"_id"`
+	Restaurant_id             string             `json:"restaurant_id"`
+	Name                      *string            `json:"name" validate:"required,min=2,max=100"`
+	Address                   *string            `json:"address"`
+	Phone                     *string            `json:"phone"`
+	Tax_number                *string            `json:"tax_number"`
+	Prices_include_tax        *bool              `json:"prices_include_tax"`                                        // Menu prices already contain tax (inclusive) or tax is added on top (exclusive)
+	Service_charge_rate       *float64           `json:"service_charge_rate" validate:"omitempty,gte=0,lte=1"`      // Share of the discounted subtotal added on dine-in orders
+	Is_default                *bool              `json:"is_default"`                                                // Used for orders that do not name a restaurant
+	Receipt_template          *ReceiptTemplate   `json:"receipt_template"`                                          // Branding of printed and PDF receipts
+	Invoice_number_format     *string            `json:"invoice_number_format"`                                     // e.g. "INV-{YEAR}-{SEQ:6}"; INVOICE_NUMBER_FORMAT when unset
+	Credit_note_number_format *string            `json:"credit_note_number_format"`                                 // e.g. "CN-{YEAR}-{SEQ:6}"; CREDIT_NOTE_NUMBER_FORMAT when unset
+	Fiscal_year_start_month   *int               `json:"fiscal_year_start_month" validate:"omitempty,min=1,max=12"` // Month the fiscal year starts in, January when unset
+	Created_at                time.Time          `json:"created_at"`
+	Updated_at                time.Time          `json:"updated_at"`
+}
+
+// ReceiptTemplate is how a restaurant brands its receipts. Empty fields fall
+// back to plain defaults.
+type ReceiptTemplate struct {
+	Header_text  string `json:"header_text"`                                                // Printed under the restaurant details, e.g. opening hours
+	Footer_text  string `json:"footer_text"`                                                // Printed at the bottom, e.g. "Thank you for your visit"
+	Accent_color string `json:"accent_color" validate:"omitempty,hexcolor"`                 // Colour of the restaurant name and headings on PDFs, e.g. #1F4E79
+	Font         string `json:"font" validate:"omitempty,eq=Helvetica|eq=Times|eq=Courier"` // PDF font family
+	Paper_width  int    `json:"paper_width" validate:"omitempty,eq=58|eq=80"`               // Default thermal paper width in mm
+}
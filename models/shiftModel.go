@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shift is one stretch of work by a staff member, from clock-in to clock-out,
+// at a station. Tip pools are shared out by the hours recorded here.
+type Shift struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Shift_id   string             `json:"shift_id"`
+	User_id    *string            `json:"user_id" validate:"required"`
+	Station    *string            `json:"station" validate:"required,eq=FLOOR|eq=KITCHEN|eq=BAR"`
+	Clock_in   time.Time          `json:"clock_in"`
+	Clock_out  *time.Time         `json:"clock_out"` // Nil while the shift is still running
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxRate is the rate charged on a tax category from Effective_from until
+// Effective_to (open-ended when nil). Rates are never edited in place: a new
+// rate with a later Effective_from supersedes the old one.
+type TaxRate struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Tax_rate_id    string             `json:"tax_rate_id"`
+	Category       *string            `json:"category" validate:"required"`
+	Name           *string            `json:"name" validate:"required"`
+	Rate           *float64           `json:"rate" validate:"required,gte=0,lt=1"`
+	Effective_from *time.Time         `json:"effective_from" validate:"required"`
+	Effective_to   *time.Time         `json:"effective_to"`
+	Created_at     time.Time          `json:"created_at"`
+	Updated_at     time.Time          `json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TipRule routes a share of every tip into the pool of a station, which is
+// then split among the staff who worked there. Whatever no rule takes stays
+// with the staff member who took the payment.
+type TipRule struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Tip_rule_id string             `json:"tip_rule_id"`
+	Name        *string            `json:"name" validate:"required"`
+	Station     *string            `json:"station" validate:"required,eq=FLOOR|eq=KITCHEN|eq=BAR"` // Station whose staff share the pool
+	Percentage  *float64           `json:"percentage" validate:"required,gt=0,lte=1"`              // Share of each tip paid into the pool, e.g. 0.1
+	Split_by    *string            `json:"split_by" validate:"required,eq=HOURS|eq=EQUAL"`         // Share the pool by hours worked or equally
+	Active      *bool              `json:"active"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
+
+// TipOut is a tip rule as it stood when a tip was taken. Payments keep them
+// so that editing a rule later does not change how past tips are shared.
+type TipOut struct {
+	Tip_rule_id string  `json:"tip_rule_id"`
+	Name        string  `json:"name"`
+	Station     string  `json:"station"`
+	Percentage  float64 `json:"percentage"`
+	Split_by    string  `json:"split_by"`
+}
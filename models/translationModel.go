@@ -0,0 +1,8 @@
+package models
+
+// Translation is the name and description of a food or menu in one language.
+// Whatever it leaves empty falls back to the default language.
+type Translation struct {
+	Name        string `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
+	Description string `json:"description,omitempty" validate:"omitempty,max=1000"`
+}
@@ -7,12 +7,17 @@ import (
 )
 
 type User struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Name       string             `json:"name" validate:"required"`
-	Category   string             `json:"category" validate:"required"`
-	Start_Date *time.Time         `json:"start_date"`
-	End_Date   *time.Time         `json:"end_date"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Menu_id    string             `json:"food_id"`
+	ID               primitive.ObjectID `bson:"_id"`
+	Name             string             `json:"name" validate:"required"`
+	Category         string             `json:"category" validate:"required"`
+	Start_Date       *time.Time         `json:"start_date"`
+	End_Date         *time.Time         `json:"end_date"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Menu_id          string             `json:"food_id"`
+	User_id          string             `json:"user_id"`
+	Role             *string            `json:"role" validate:"omitempty,eq=ADMIN|eq=MANAGER|eq=STAFF"`
+	Pin              *string            `json:"-"` // bcrypt hash of the approval PIN used by managers
+	Pin_failures     int                `json:"-"` // Wrong PINs entered in a row
+	Pin_locked_until *time.Time         `json:"-"` // PIN checks are refused until then after too many wrong PINs
 }
@@ -0,0 +1,201 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FakeProviderName is the name the local fake gateway is registered under.
+const FakeProviderName = "fake"
+
+// Card tokens understood by the fake gateway. Any other token is approved.
+const (
+	FakeTokenApprove           = "tok_approve"
+	FakeTokenDecline           = "tok_decline"
+	FakeTokenInsufficientFunds = "tok_insufficient_funds"
+	FakeTokenDelay             = "tok_delay" // Stays PENDING for FAKE_PAYMENT_DELAY, then is authorized
+)
+
+// FakeProvider is an in-memory gateway for local development, tests and staff
+// training. Nothing leaves the process except, when FAKE_PAYMENT_WEBHOOK_URL
+// is set, the signed webhook sent once a delayed payment is authorized.
+type FakeProvider struct {
+	mu            sync.Mutex
+	transactions  map[string]*Result
+	delay         time.Duration
+	webhookURL    string
+	webhookSecret string
+}
+
+// NewFakeProvider reads its settings from FAKE_PAYMENT_DELAY (default 5s),
+// FAKE_PAYMENT_WEBHOOK_URL and PAYMENT_WEBHOOK_SECRET.
+func NewFakeProvider() *FakeProvider {
+	delay, err := time.ParseDuration(os.Getenv("FAKE_PAYMENT_DELAY"))
+	if err != nil || delay <= 0 {
+		delay = 5 * time.Second
+	}
+	return &FakeProvider{
+		transactions:  map[string]*Result{},
+		delay:         delay,
+		webhookURL:    os.Getenv("FAKE_PAYMENT_WEBHOOK_URL"),
+		webhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+	}
+}
+
+func init() {
+	Register(NewFakeProvider())
+}
+
+func (p *FakeProvider) Name() string {
+	return FakeProviderName
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, request AuthorizeRequest) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := &Result{
+		Transaction_id: "fake_" + primitive.NewObjectID().Hex(),
+		Status:         StatusAuthorized,
+		Amount:         request.Amount,
+		Refunded:       models.Money{Currency: request.Amount.Currency},
+	}
+
+	switch request.Card_token {
+	case FakeTokenDecline:
+		result.Status = StatusDeclined
+		result.Decline_reason = "card declined"
+	case FakeTokenInsufficientFunds:
+		result.Status = StatusDeclined
+		result.Decline_reason = "insufficient funds"
+	case FakeTokenDelay:
+		result.Status = StatusPending
+		time.AfterFunc(p.delay, func() { p.completeDelayed(result.Transaction_id) })
+	}
+
+	p.transactions[result.Transaction_id] = result
+	return *result, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, transactionId string, amount models.Money) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.transactions[transactionId]
+	if !ok {
+		return Result{}, ErrTransactionNotFound
+	}
+	if result.Status != StatusAuthorized {
+		return *result, fmt.Errorf("cannot capture a %s transaction", result.Status)
+	}
+	if amount.Amount > result.Amount.Amount {
+		return *result, errors.New("cannot capture more than was authorized")
+	}
+
+	result.Status = StatusCaptured
+	result.Amount = amount
+	return *result, nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, transactionId string) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.transactions[transactionId]
+	if !ok {
+		return Result{}, ErrTransactionNotFound
+	}
+	if result.Status != StatusPending && result.Status != StatusAuthorized && result.Status != StatusCaptured {
+		return *result, fmt.Errorf("cannot void a %s transaction", result.Status)
+	}
+
+	result.Status = StatusVoided
+	return *result, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, transactionId string, amount models.Money) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.transactions[transactionId]
+	if !ok {
+		return Result{}, ErrTransactionNotFound
+	}
+	if result.Status != StatusCaptured && result.Status != StatusRefunded {
+		return *result, fmt.Errorf("cannot refund a %s transaction", result.Status)
+	}
+	if result.Refunded.Add(amount).Amount > result.Amount.Amount {
+		return *result, errors.New("cannot refund more than was captured")
+	}
+
+	result.Status = StatusRefunded
+	result.Refunded = result.Refunded.Add(amount)
+	return *result, nil
+}
+
+func (p *FakeProvider) Status(ctx context.Context, transactionId string) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.transactions[transactionId]
+	if !ok {
+		return Result{}, ErrTransactionNotFound
+	}
+	return *result, nil
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, signature string) (WebhookEvent, error) {
+	var event WebhookEvent
+	if !VerifySignature(p.webhookSecret, payload, signature) {
+		return event, errors.New("webhook signature is invalid")
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+// completeDelayed authorizes a delayed payment and notifies the webhook, the
+// way a real gateway reports the outcome of a payment it could not settle at once.
+func (p *FakeProvider) completeDelayed(transactionId string) {
+	p.mu.Lock()
+	result, ok := p.transactions[transactionId]
+	if !ok || result.Status != StatusPending {
+		p.mu.Unlock()
+		return
+	}
+	result.Status = StatusAuthorized
+	event := WebhookEvent{Transaction_id: result.Transaction_id, Status: result.Status, Amount: result.Amount}
+	p.mu.Unlock()
+
+	if p.webhookURL == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(event)
+	request, err := http.NewRequest(http.MethodPost, p.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Println("fake payment webhook was not sent:", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, Sign(p.webhookSecret, payload))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Println("fake payment webhook was not sent:", err)
+		return
+	}
+	response.Body.Close()
+}
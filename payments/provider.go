@@ -0,0 +1,114 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang-Hotel_Management/models"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Transaction statuses reported by a provider.
+const (
+	StatusPending    = "PENDING"    // Waiting on the provider, settled later by a webhook or status lookup
+	StatusAuthorized = "AUTHORIZED" // Funds are held but not yet taken
+	StatusCaptured   = "CAPTURED"   // Funds are taken
+	StatusDeclined   = "DECLINED"   // The card or the provider refused the payment
+	StatusVoided     = "VOIDED"     // The authorization or capture was cancelled
+	StatusRefunded   = "REFUNDED"   // Part or all of a capture was paid back
+)
+
+// SignatureHeader carries the HMAC of a webhook body.
+const SignatureHeader = "X-Payment-Signature"
+
+// ErrTransactionNotFound is returned when a provider does not know a transaction id.
+var ErrTransactionNotFound = errors.New("payment transaction was not found")
+
+// AuthorizeRequest asks a provider to hold an amount on a card.
+type AuthorizeRequest struct {
+	Amount     models.Money
+	Card_token string // Token from the card terminal or the provider's hosted fields
+	Reference  string // Our own reference, usually the invoice id
+}
+
+// Result is what a provider reports about a transaction after a call.
+type Result struct {
+	Transaction_id string       `json:"transaction_id"`
+	Status         string       `json:"status"`
+	Amount         models.Money `json:"amount"`                   // Amount authorized or captured
+	Refunded       models.Money `json:"refunded"`                 // Total refunded so far
+	Decline_reason string       `json:"decline_reason,omitempty"` // Set when Status is DECLINED
+}
+
+// WebhookEvent is a verified notification that a transaction changed status.
+type WebhookEvent struct {
+	Transaction_id string       `json:"transaction_id"`
+	Status         string       `json:"status"`
+	Amount         models.Money `json:"amount"`
+	Decline_reason string       `json:"decline_reason,omitempty"`
+}
+
+// Provider is a card payment gateway. A real gateway is added by implementing
+// this interface and registering it under its name.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, request AuthorizeRequest) (Result, error)
+	Capture(ctx context.Context, transactionId string, amount models.Money) (Result, error)
+	Void(ctx context.Context, transactionId string) (Result, error)
+	Refund(ctx context.Context, transactionId string, amount models.Money) (Result, error)
+	Status(ctx context.Context, transactionId string) (Result, error)
+	// ParseWebhook checks the signature of a webhook body and decodes it.
+	ParseWebhook(payload []byte, signature string) (WebhookEvent, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+// Register makes a provider available under its name.
+func Register(provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[strings.ToLower(provider.Name())] = provider
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	provider, ok := providers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %q is not configured", name)
+	}
+	return provider, nil
+}
+
+// Default returns the provider named by PAYMENT_PROVIDER, the fake one when unset.
+func Default() (Provider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" {
+		name = FakeProviderName
+	}
+	return Get(name)
+}
+
+// Sign returns the hex HMAC-SHA256 of a webhook body.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature compares a webhook signature in constant time.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
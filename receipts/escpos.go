@@ -0,0 +1,198 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ESC/POS commands understood by common thermal receipt printers.
+var (
+	escInit        = []byte{0x1b, '@'}                  // Reset the printer
+	escAlignLeft   = []byte{0x1b, 'a', 0}               // Left-align the following lines
+	escAlignCenter = []byte{0x1b, 'a', 1}               // Centre the following lines
+	escBoldOn      = []byte{0x1b, 'E', 1}               // Emphasised text on
+	escBoldOff     = []byte{0x1b, 'E', 0}               // Emphasised text off
+	escDoubleOn    = []byte{0x1d, '!', 0x11}            // Double width and height
+	escDoubleOff   = []byte{0x1d, '!', 0}               // Normal size
+	escFeedAndCut  = []byte{0x1b, 'd', 4, 0x1d, 'V', 1} // Feed four lines and partially cut
+)
+
+// Columns returns how many characters fit on a line of thermal paper of the
+// given width in millimetres, using the printer's standard font.
+func Columns(paperWidth int) (int, error) {
+	switch paperWidth {
+	case 58:
+		return 32, nil
+	case 80:
+		return 48, nil
+	}
+	return 0, fmt.Errorf("paper width must be 58 or 80 mm, got %d", paperWidth)
+}
+
+// PaperWidth returns the restaurant's default thermal paper width in mm.
+func (r Receipt) PaperWidth() int {
+	return r.template().Paper_width
+}
+
+// RenderESCPOS writes the receipt as text for a thermal printer. With commands
+// set, ESC/POS control codes for alignment, emphasis and the paper cut are
+// included; without, the output is plain text of the same layout.
+func RenderESCPOS(w io.Writer, r Receipt, paperWidth int, commands bool) error {
+	columns, err := Columns(paperWidth)
+	if err != nil {
+		return err
+	}
+
+	t := r.template()
+	invoice := r.Invoice
+	var b bytes.Buffer
+
+	command := func(code []byte) {
+		if commands {
+			b.Write(code)
+		}
+	}
+	line := func(text string) {
+		b.WriteString(text)
+		b.WriteByte('\n')
+	}
+	rule := func() {
+		line(strings.Repeat("-", columns))
+	}
+	amountLine := func(label, amount string) {
+		line(twoColumns(label, amount, columns))
+	}
+
+	command(escInit)
+
+	// Restaurant details, centred
+	name, details := r.restaurantLines()
+	command(escAlignCenter)
+	command(escDoubleOn)
+	// Double-width text only fits half as many characters
+	if commands {
+		line(truncate(name, columns/2))
+	} else {
+		line(centre(truncate(name, columns), columns))
+	}
+	command(escDoubleOff)
+	for _, detail := range append(details, wrap(t.Header_text, columns)...) {
+		if commands {
+			line(truncate(detail, columns))
+		} else {
+			line(centre(truncate(detail, columns), columns))
+		}
+	}
+	command(escAlignLeft)
+	rule()
+
+	line("Invoice " + r.number())
+	if invoice.Voided {
+		line("*** VOIDED ***")
+	}
+	line("Date: " + invoice.Created_at.Format("2006-01-02 15:04"))
+	if table := r.table(); table != "" {
+		line("Table: " + table)
+	}
+	if invoice.Split_count > 0 {
+		line(fmt.Sprintf("Split bill: part %d of %d", invoice.Split_part, invoice.Split_count))
+	}
+	rule()
+
+	for _, item := range invoice.Line_items {
+		label := strconv.Itoa(item.Quantity) + " x " + itemLabel(item)
+		amountLine(label, item.Amount.String())
+		if item.Quantity > 1 {
+			line("    @ " + item.Unit_price.String())
+		}
+	}
+	rule()
+
+	writeTotals := func(lines []totalLine) {
+		for _, total := range lines {
+			if total.Bold {
+				command(escBoldOn)
+			}
+			amountLine(total.Label, total.Amount.String())
+			if total.Bold {
+				command(escBoldOff)
+			}
+		}
+	}
+	writeTotals(r.totals())
+
+	if payments := r.paymentLines(); len(payments) > 0 {
+		rule()
+		writeTotals(payments)
+	}
+
+	line("")
+	command(escAlignCenter)
+	for _, footer := range wrap(t.Footer_text, columns) {
+		if commands {
+			line(footer)
+		} else {
+			line(centre(footer, columns))
+		}
+	}
+	command(escFeedAndCut)
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// twoColumns puts label on the left and amount on the right of one line,
+// shortening the label when both do not fit.
+func twoColumns(label, amount string, columns int) string {
+	space := columns - utf8.RuneCountInString(amount) - 1
+	label = truncate(label, space)
+	padding := columns - utf8.RuneCountInString(label) - utf8.RuneCountInString(amount)
+	return label + strings.Repeat(" ", padding) + amount
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width])
+}
+
+func centre(s string, width int) string {
+	padding := (width - utf8.RuneCountInString(s)) / 2
+	if padding <= 0 {
+		return s
+	}
+	return strings.Repeat(" ", padding) + s
+}
+
+// wrap breaks text into lines of at most width characters at word boundaries.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		current := ""
+		for _, word := range strings.Fields(paragraph) {
+			word = truncate(word, width)
+			switch {
+			case current == "":
+				current = word
+			case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+				current += " " + word
+			default:
+				lines = append(lines, current)
+				current = word
+			}
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+	}
+	return lines
+}
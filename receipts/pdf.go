@@ -0,0 +1,151 @@
+package receipts
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// fontFaces holds the embedded TrueType faces receipts are printed with, per
+// family and style. Being UTF-8 fonts they print any name as entered, accents
+// and all. Helvetica and Times are printed in the proportional Go face and
+// Courier in Go Mono.
+var fontFaces = map[string]map[string][]byte{
+	"Go":     {"": goregular.TTF, "B": gobold.TTF, "I": goitalic.TTF},
+	"GoMono": {"": gomono.TTF, "B": gomonobold.TTF, "I": gomonoitalic.TTF},
+}
+
+// fontFamily returns the embedded family a template font is printed in.
+func fontFamily(font string) string {
+	if font == "Courier" {
+		return "GoMono"
+	}
+	return "Go"
+}
+
+// RenderPDF writes the receipt as an A4 PDF invoice.
+func RenderPDF(w io.Writer, r Receipt) error {
+	t := r.template()
+	invoice := r.Invoice
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 25)
+	t.Font = fontFamily(t.Font)
+	for style, face := range fontFaces[t.Font] {
+		pdf.AddUTF8FontFromBytes(t.Font, style, face)
+	}
+
+	red, green, blue := hexColor(t.Accent_color)
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 40
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-20)
+		pdf.SetFont(t.Font, "I", 9)
+		pdf.SetTextColor(100, 100, 100)
+		pdf.CellFormat(0, 5, t.Footer_text, "", 1, "C", false, 0, "")
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Restaurant details
+	name, details := r.restaurantLines()
+	pdf.SetFont(t.Font, "B", 18)
+	pdf.SetTextColor(red, green, blue)
+	pdf.CellFormat(0, 9, name, "", 1, "L", false, 0, "")
+	pdf.SetFont(t.Font, "", 10)
+	pdf.SetTextColor(0, 0, 0)
+	for _, line := range details {
+		pdf.CellFormat(0, 5, line, "", 1, "L", false, 0, "")
+	}
+	if t.Header_text != "" {
+		pdf.Ln(2)
+		pdf.MultiCell(0, 5, t.Header_text, "", "L", false)
+	}
+	pdf.Ln(6)
+
+	// Invoice details
+	pdf.SetFont(t.Font, "B", 12)
+	pdf.CellFormat(0, 7, "Invoice "+r.number(), "", 1, "L", false, 0, "")
+	if invoice.Voided {
+		pdf.SetTextColor(200, 0, 0)
+		pdf.CellFormat(0, 7, "VOIDED", "", 1, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.SetFont(t.Font, "", 10)
+	pdf.CellFormat(0, 5, "Date: "+invoice.Created_at.Format("2006-01-02 15:04"), "", 1, "L", false, 0, "")
+	if table := r.table(); table != "" {
+		pdf.CellFormat(0, 5, "Table: "+table, "", 1, "L", false, 0, "")
+	}
+	if invoice.Split_count > 0 {
+		pdf.CellFormat(0, 5, fmt.Sprintf("Split bill: part %d of %d", invoice.Split_part, invoice.Split_count), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Item lines
+	columns := []float64{15, contentWidth - 75, 30, 30}
+	pdf.SetFont(t.Font, "B", 10)
+	pdf.SetDrawColor(red, green, blue)
+	for i, heading := range []string{"Qty", "Item", "Unit price", "Amount"} {
+		align := "R"
+		if i == 1 {
+			align = "L"
+		}
+		pdf.CellFormat(columns[i], 7, heading, "B", 0, align, false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(t.Font, "", 10)
+	for _, line := range invoice.Line_items {
+		pdf.CellFormat(columns[0], 6, strconv.Itoa(line.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(columns[1], 6, itemLabel(line), "", 0, "L", false, 0, "")
+		pdf.CellFormat(columns[2], 6, line.Unit_price.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(columns[3], 6, line.Amount.String(), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(2)
+	pdf.Line(20, pdf.GetY(), pageWidth-20, pdf.GetY())
+	pdf.Ln(2)
+
+	// Totals and payments, right-aligned under the amounts column
+	writeTotals := func(lines []totalLine) {
+		for _, line := range lines {
+			style := ""
+			if line.Bold {
+				style = "B"
+			}
+			pdf.SetFont(t.Font, style, 10)
+			pdf.CellFormat(contentWidth-30, 6, line.Label, "", 0, "R", false, 0, "")
+			pdf.CellFormat(30, 6, line.Amount.String(), "", 1, "R", false, 0, "")
+		}
+	}
+	writeTotals(r.totals())
+
+	if payments := r.paymentLines(); len(payments) > 0 {
+		pdf.Ln(4)
+		pdf.SetFont(t.Font, "B", 11)
+		pdf.SetTextColor(red, green, blue)
+		pdf.CellFormat(0, 7, "Payments", "", 1, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		writeTotals(payments)
+	}
+
+	return pdf.Output(w)
+}
+
+// hexColor splits a "#RRGGBB" colour into its components, black when invalid.
+func hexColor(color string) (int, int, int) {
+	var red, green, blue int
+	if _, err := fmt.Sscanf(color, "#%02x%02x%02x", &red, &green, &blue); err != nil {
+		return 0, 0, 0
+	}
+	return red, green, blue
+}
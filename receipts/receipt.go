@@ -0,0 +1,163 @@
+package receipts
+
+import (
+	"fmt"
+	"golang-Hotel_Management/models"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Receipt is everything printed on a guest's receipt.
+type Receipt struct {
+	Invoice    models.Invoice
+	Restaurant models.Restaurant
+	Payments   []models.Payment // Only payments that were actually taken
+}
+
+// template returns the restaurant's receipt template with defaults filled in.
+func (r Receipt) template() models.ReceiptTemplate {
+	var t models.ReceiptTemplate
+	if r.Restaurant.Receipt_template != nil {
+		t = *r.Restaurant.Receipt_template
+	}
+	if t.Font == "" {
+		t.Font = "Helvetica"
+	}
+	if t.Accent_color == "" {
+		t.Accent_color = "#000000"
+	}
+	if t.Footer_text == "" {
+		t.Footer_text = "Thank you for your visit"
+	}
+	if t.Paper_width == 0 {
+		t.Paper_width = 80
+	}
+	return t
+}
+
+// number is the invoice's legal number, or its id for invoices issued before
+// invoices were numbered.
+func (r Receipt) number() string {
+	if r.Invoice.Invoice_number != "" {
+		return r.Invoice.Invoice_number
+	}
+	return r.Invoice.Invoice_id
+}
+
+// table is the number of the table the invoice was for, stored as text or
+// as a number, or "" when it has none.
+func (r Receipt) table() string {
+	if r.Invoice.Table_number == nil {
+		return ""
+	}
+	return fmt.Sprint(r.Invoice.Table_number)
+}
+
+// restaurantLines returns the restaurant's name and contact details, one per line.
+func (r Receipt) restaurantLines() (string, []string) {
+	name := "Receipt"
+	if r.Restaurant.Name != nil {
+		name = *r.Restaurant.Name
+	}
+
+	var lines []string
+	if r.Restaurant.Address != nil && *r.Restaurant.Address != "" {
+		lines = append(lines, *r.Restaurant.Address)
+	}
+	if r.Restaurant.Phone != nil && *r.Restaurant.Phone != "" {
+		lines = append(lines, "Tel. "+*r.Restaurant.Phone)
+	}
+	if r.Restaurant.Tax_number != nil && *r.Restaurant.Tax_number != "" {
+		lines = append(lines, "Tax no. "+*r.Restaurant.Tax_number)
+	}
+	return name, lines
+}
+
+// totalLine is one labelled amount in the totals block.
+type totalLine struct {
+	Label  string
+	Amount models.Money
+	Bold   bool
+}
+
+// totals lists the amounts between the item lines and the payments, in the
+// order they are printed.
+func (r Receipt) totals() []totalLine {
+	invoice := r.Invoice
+	lines := []totalLine{{Label: "Subtotal", Amount: invoice.Subtotal}}
+
+	for _, discount := range invoice.Discounts {
+		lines = append(lines, totalLine{Label: discount.Description, Amount: discount.Amount.Mul(-1)})
+	}
+	if !invoice.Service_charge.IsZero() {
+		lines = append(lines, totalLine{Label: "Service charge", Amount: invoice.Service_charge})
+	}
+	if !invoice.Delivery_fee.IsZero() {
+		lines = append(lines, totalLine{Label: "Delivery fee", Amount: invoice.Delivery_fee})
+	}
+
+	// Inclusive taxes are shown for information only; they are already in the prices.
+	prefix := ""
+	if invoice.Prices_include_tax {
+		prefix = "incl. "
+	}
+	for _, tax := range invoice.Taxes {
+		lines = append(lines, totalLine{Label: fmt.Sprintf("%s%s %s%%", prefix, tax.Name, formatRate(tax.Rate)), Amount: tax.Amount})
+	}
+
+	lines = append(lines, totalLine{Label: "Total", Amount: invoice.Grand_total, Bold: true})
+	return lines
+}
+
+// paymentLines lists the payments taken, followed by the balance still due.
+func (r Receipt) paymentLines() []totalLine {
+	var lines []totalLine
+	for _, payment := range r.Payments {
+		method := strings.ReplaceAll(*payment.Method, "_", " ")
+		if *payment.Method == "CASH" && !payment.Change.IsZero() {
+			lines = append(lines, totalLine{Label: "Cash tendered", Amount: payment.Tendered})
+			if !payment.Tip.IsZero() {
+				lines = append(lines, totalLine{Label: "Tip", Amount: payment.Tip})
+			}
+			lines = append(lines, totalLine{Label: "Change", Amount: payment.Change})
+			continue
+		}
+		lines = append(lines, totalLine{Label: titleCase(method), Amount: payment.Amount})
+		if !payment.Tip.IsZero() {
+			lines = append(lines, totalLine{Label: "Tip", Amount: payment.Tip})
+		}
+	}
+	if !r.Invoice.Amount_refunded.IsZero() {
+		lines = append(lines, totalLine{Label: "Refunded", Amount: r.Invoice.Amount_refunded.Mul(-1)})
+	}
+	if r.Invoice.Balance_due.Amount > 0 {
+		lines = append(lines, totalLine{Label: "Balance due", Amount: r.Invoice.Balance_due, Bold: true})
+	}
+	return lines
+}
+
+// itemLabel names an invoice line, e.g. "Margherita (L)".
+func itemLabel(line models.InvoiceLine) string {
+	name := line.Name
+	if name == "" {
+		name = "Item"
+	}
+	if line.Size != "" {
+		name += " (" + line.Size + ")"
+	}
+	return name
+}
+
+// formatRate prints a tax rate such as 0.075 as "7.5".
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(math.Round(rate*1e6)/1e4, 'f', -1, 64)
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
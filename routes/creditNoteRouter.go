@@ -0,0 +1,12 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreditNoteRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/creditNotes", controller.GetCreditNotes())
+	incomingRoutes.GET("/creditNotes/:credit_note_id", controller.GetCreditNote())
+}
@@ -13,6 +13,12 @@ func FoodRoutes(incomingRoutes *gin.Engine) {
 	// GET endpoint to retrieve a list of all food items
 	incomingRoutes.GET("/foods", controller.GetFoods())
 
+	// GET endpoint to retrieve the "86" list of sold out food items
+	incomingRoutes.GET("/foods/sold-out", controller.GetSoldOutFoods())
+
+	// GET endpoint streaming availability changes to terminals as server-sent events
+	incomingRoutes.GET("/foods/availability/stream", controller.StreamFoodAvailability())
+
 	// GET endpoint to retrieve details of a specific food item by its ID
 	incomingRoutes.GET("/foods/:food_id", controller.GetFood())
 
@@ -23,4 +29,15 @@ func FoodRoutes(incomingRoutes *gin.Engine) {
 	// NOTE: It should be "/foods/:food_id" instead of "/foods/food_id"
 	//       to correctly capture the path parameter
 	incomingRoutes.PATCH("/foods/:food_id", controller.UpdateFood())
+
+	// PATCH endpoint for the kitchen to mark a food sold out or set its remaining portions
+	incomingRoutes.PATCH("/foods/:food_id/availability", controller.UpdateFoodAvailability())
+
+	// POST endpoint to upload the food's picture as a multipart form with an "image" file
+	incomingRoutes.POST("/foods/:food_id/image", controller.UploadFoodImage())
+
+	// Price history of a food, and new or scheduled prices with their author
+	incomingRoutes.GET("/foods/:food_id/prices", controller.GetFoodPrices())
+	incomingRoutes.POST("/foods/:food_id/prices", controller.CreatePriceChange())
+	incomingRoutes.POST("/foods/:food_id/prices/:price_change_id/cancel", controller.CancelPriceChange())
 }
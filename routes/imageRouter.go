@@ -0,0 +1,12 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageRoutes serve stored images without a login.
+func ImageRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/images/*key", controller.ServeImage())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InventoryRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/ingredients", controller.GetIngredients())
+	incomingRoutes.GET("/ingredients/:ingredient_id", controller.GetIngredient())
+	incomingRoutes.POST("/ingredients", controller.CreateIngredient())
+	incomingRoutes.PATCH("/ingredients/:ingredient_id", controller.UpdateIngredient())
+	incomingRoutes.GET("/ingredients/:ingredient_id/movements", controller.GetStockMovements())
+	incomingRoutes.POST("/ingredients/:ingredient_id/movements", controller.RecordStockMovement())
+	incomingRoutes.GET("/foods/:food_id/recipe", controller.GetRecipe())
+	incomingRoutes.PUT("/foods/:food_id/recipe", controller.SetRecipe())
+	incomingRoutes.GET("/stockAlerts", controller.GetStockAlerts())
+}
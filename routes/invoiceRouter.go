@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-Hotel_Management/controllers"
+	"golang-Hotel_Management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,6 +10,12 @@ import (
 func InvoiceRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/invoices", controller.GetInvoices())
 	incomingRoutes.GET("/invoices/:invoice_id", controller.GetInvoice())
-	incomingRoutes.POST("/invoices", controller.CreateInvoice())
-	incomingRoutes.PATCH("/invoices/invoice_id", controller.UpdateInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/pdf", controller.GetInvoicePDF())
+	incomingRoutes.GET("/invoices/:invoice_id/receipt", controller.GetInvoiceReceipt())
+	incomingRoutes.POST("/invoices", middleware.Idempotency(), controller.CreateInvoice())
+	incomingRoutes.PATCH("/invoices/:invoice_id", controller.UpdateInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/payments", controller.GetInvoicePayments())
+	incomingRoutes.POST("/invoices/:invoice_id/payments", middleware.Idempotency(), controller.CreatePayment())
+	incomingRoutes.POST("/invoices/:invoice_id/refunds", middleware.Idempotency(), controller.RefundInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/void", controller.VoidInvoice())
 }
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func KitchenRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/kitchen/tickets", controller.GetKitchenTickets())
+}
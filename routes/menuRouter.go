@@ -8,7 +8,19 @@ import (
 
 func MenuRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/menus", controller.GetMenus())
+	incomingRoutes.GET("/menus/active", controller.GetActiveMenus())
 	incomingRoutes.GET("/menus/:menu_id", controller.GetMenu())
 	incomingRoutes.POST("/menus", controller.CreateMenu())
-	incomingRoutes.PATCH("/menus/menus_id", controller.UpdateMenu())
+	incomingRoutes.PATCH("/menus/:menu_id", controller.UpdateMenu())
+	incomingRoutes.GET("/menus/:menu_id/versions", controller.GetMenuVersions())
+	incomingRoutes.POST("/menus/:menu_id/versions/:version/rollback", controller.RollbackMenu())
+	incomingRoutes.GET("/menus/:menu_id/draft", controller.GetMenuDraft())
+	incomingRoutes.POST("/menus/:menu_id/draft", controller.CreateMenuDraft())
+	incomingRoutes.PATCH("/menus/:menu_id/draft", controller.UpdateMenuDraft())
+	incomingRoutes.DELETE("/menus/:menu_id/draft", controller.DiscardMenuDraft())
+	incomingRoutes.GET("/menus/:menu_id/draft/diff", controller.GetMenuDraftDiff())
+	incomingRoutes.POST("/menus/:menu_id/draft/publish", controller.PublishMenuDraft())
+	incomingRoutes.POST("/menus/:menu_id/draft/foods", controller.AddDraftFood())
+	incomingRoutes.PUT("/menus/:menu_id/draft/foods/:food_id", controller.SetDraftFood())
+	incomingRoutes.DELETE("/menus/:menu_id/draft/foods/:food_id", controller.RemoveDraftFood())
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-Hotel_Management/controllers"
+	"golang-Hotel_Management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,6 +11,7 @@ func OrderItemRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orderItems", controller.GetOrderItems())
 	incomingRoutes.GET("/orderItems/:orderItem_id", controller.GetOrderItem())
 	incomingRoutes.GET("/orderItems-order/:order_id", controller.GetOrderItemByOrder())
-	incomingRoutes.POST("/orderItems", controller.CreateOrderItem())
-	incomingRoutes.PATCH("/orderItems/orderItem_id", controller.UpdateOrderItem())
+	incomingRoutes.POST("/orderItems", middleware.Idempotency(), controller.CreateOrderItem())
+	incomingRoutes.PATCH("/orderItems/:orderItem_id", controller.UpdateOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/void", controller.VoidOrderItem())
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-Hotel_Management/controllers"
+	"golang-Hotel_Management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,6 +10,11 @@ import (
 func OrderRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orders", controller.GetOrders())
 	incomingRoutes.GET("/orders/:order_id", controller.GetOrder())
-	incomingRoutes.POST("/orders", controller.CreateOrder())
+	incomingRoutes.POST("/orders", middleware.Idempotency(), controller.CreateOrder())
 	incomingRoutes.PATCH("/orders/order_id", controller.UpdateOrder())
+	incomingRoutes.POST("/orders/:order_id/send", controller.SendOrder())
+	incomingRoutes.POST("/orders/:order_id/void", controller.VoidOrder())
+	incomingRoutes.POST("/orders/:order_id/split", middleware.Idempotency(), controller.SplitOrderBill())
+	incomingRoutes.POST("/orders/:order_id/courses/:course/fire", controller.FireCourse())
+	incomingRoutes.POST("/orders/:order_id/courses/:course/serve", controller.ServeCourse())
 }
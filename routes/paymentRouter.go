@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PaymentRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/payments/:payment_id/status", controller.GetPaymentStatus())
+	incomingRoutes.POST("/payments/:payment_id/void", controller.VoidPayment())
+}
+
+// PaymentWebhookRoutes are called by payment providers, which cannot log in;
+// each request is authenticated by its signature instead.
+func PaymentWebhookRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/webhooks/payments/:provider", controller.PaymentWebhook())
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reports/voids", controller.GetVoidReport())
+	incomingRoutes.GET("/reports/course-pacing", controller.GetCoursePacingReport())
+	incomingRoutes.GET("/reports/tax-summary", controller.GetTaxSummaryReport())
+	incomingRoutes.GET("/reports/sales", controller.GetSalesReport())
+	incomingRoutes.GET("/reports/tips", controller.GetTipReport())
+	incomingRoutes.GET("/reports/translations", controller.GetTranslationReport())
+	incomingRoutes.GET("/reports/food-sales", controller.GetFoodSalesReport())
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RestaurantRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/restaurants", controller.GetRestaurants())
+	incomingRoutes.GET("/restaurants/:restaurant_id", controller.GetRestaurant())
+	incomingRoutes.POST("/restaurants", controller.CreateRestaurant())
+	incomingRoutes.PATCH("/restaurants/:restaurant_id", controller.UpdateRestaurant())
+}
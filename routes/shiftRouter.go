@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ShiftRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/shifts", controller.GetShifts())
+	incomingRoutes.POST("/shifts", controller.ClockIn())
+	incomingRoutes.POST("/shifts/:shift_id/clock-out", controller.ClockOut())
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TaxRateRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/taxRates", controller.GetTaxRates())
+	incomingRoutes.POST("/taxRates", controller.CreateTaxRate())
+}
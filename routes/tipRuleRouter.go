@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "golang-Hotel_Management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TipRuleRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/tipRules", controller.GetTipRules())
+	incomingRoutes.POST("/tipRules", controller.CreateTipRule())
+	incomingRoutes.PATCH("/tipRules/:tip_rule_id", controller.UpdateTipRule())
+}
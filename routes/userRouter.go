@@ -12,3 +12,9 @@ func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("/users/signup", controller.SignUp())
 	incomingRoutes.POST("/users/login", controller.Login())
 }
+
+// UserPinRoutes are registered after authentication: only a signed-in
+// manager or admin may set an approval PIN.
+func UserPinRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.PUT("/users/:user_id/pin", controller.SetUserPin())
+}
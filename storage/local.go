@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps files in a directory on the server's own disk.
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{Root: root}
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file to a temporary name first, so that a reader never sees
+// half of it.
+func (s *LocalStore) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get opens a stored file. The content type comes from the key's extension.
+func (s *LocalStore) Get(ctx context.Context, key string) (Object, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return Object{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return Object{}, ErrNotFound
+	}
+
+	return Object{
+		Body:          file,
+		Content_type:  mime.TypeByExtension(filepath.Ext(name)),
+		Size:          info.Size(),
+		Last_modified: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
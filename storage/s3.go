@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// now is the clock requests are signed with.
+var now = time.Now
+
+// S3Store keeps files in a bucket of any S3-compatible service: AWS S3, or a
+// local stand-in such as MinIO when S3_ENDPOINT points at it. Requests are
+// signed with AWS Signature Version 4.
+type S3Store struct {
+	Endpoint   string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Region     string
+	Bucket     string
+	Access_key string
+	Secret_key string
+	Path_style bool // Address the bucket in the path rather than the host name
+	Client     *http.Client
+}
+
+// NewS3StoreFromEnv configures an S3Store from S3_ENDPOINT, S3_REGION,
+// S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_PATH_STYLE.
+func NewS3StoreFromEnv() (*S3Store, error) {
+	store := &S3Store{
+		Endpoint:   strings.TrimRight(envOr("S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+		Region:     envOr("S3_REGION", "us-east-1"),
+		Bucket:     os.Getenv("S3_BUCKET"),
+		Access_key: os.Getenv("S3_ACCESS_KEY_ID"),
+		Secret_key: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Path_style: true,
+		Client:     &http.Client{Timeout: 30 * time.Second},
+	}
+	if value := os.Getenv("S3_PATH_STYLE"); value != "" {
+		pathStyle, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("S3_PATH_STYLE must be true or false")
+		}
+		store.Path_style = pathStyle
+	}
+	if store.Bucket == "" || store.Access_key == "" || store.Secret_key == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set")
+	}
+	return store, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	request, err := s.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	s.sign(request, body)
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return s.failure("put", key, response)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (Object, error) {
+	request, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	s.sign(request, nil)
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return Object{}, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return Object{}, ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return Object{}, s.failure("get", key, response)
+	}
+
+	lastModified, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+	return Object{
+		Body:          response.Body,
+		Content_type:  response.Header.Get("Content-Type"),
+		Size:          response.ContentLength,
+		Last_modified: lastModified,
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	request, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(request, nil)
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return s.failure("delete", key, response)
+	}
+	return nil
+}
+
+// request builds an unsigned request for the object under key.
+func (s *S3Store) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	objectPath := "/" + escapePath(key)
+	if s.Path_style {
+		objectPath = "/" + escapePath(s.Bucket) + objectPath
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+	}
+	endpoint.RawPath = objectPath
+	endpoint.Path, _ = url.PathUnescape(objectPath)
+
+	return http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+}
+
+// sign adds the Signature Version 4 headers to a request.
+func (s *S3Store) sign(request *http.Request, body []byte) {
+	signedAt := now().UTC()
+	amzDate := signedAt.Format("20060102T150405Z")
+	day := signedAt.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.Secret_key), day)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Access_key, scope, signedHeaders, signature,
+	))
+}
+
+// failure turns an unexpected S3 response into an error carrying its message.
+func (s *S3Store) failure(operation, key string, response *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("s3 %s %s failed with status %d: %s", operation, key, response.StatusCode, strings.TrimSpace(string(message)))
+}
+
+// escapePath percent-encodes a key the way S3 expects in the canonical
+// request: everything but unreserved characters and the slashes between
+// segments.
+func escapePath(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("object was not found")
+
+// Object is a stored file being read back.
+type Object struct {
+	Body          io.ReadCloser
+	Content_type  string
+	Size          int64
+	Last_modified time.Time
+}
+
+// Store keeps files under slash-separated keys such as
+// "foods/<food_id>/<hash>-card.jpg". Keys are never reused for different
+// content, so whatever serves them may cache them indefinitely.
+type Store interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Get(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore Store
+	defaultErr   error
+)
+
+// Default returns the store named by STORAGE_BACKEND: "local" (the default)
+// or "s3".
+func Default() (Store, error) {
+	defaultOnce.Do(func() {
+		switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+		case "", "local":
+			defaultStore = NewLocalStore(envOr("STORAGE_DIR", "uploads"))
+		case "s3":
+			defaultStore, defaultErr = NewS3StoreFromEnv()
+		default:
+			defaultErr = fmt.Errorf("storage backend %q is not supported", backend)
+		}
+	})
+	return defaultStore, defaultErr
+}
+
+// CleanKey checks that a key stays inside the store and normalises it.
+func CleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return cleaned, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}